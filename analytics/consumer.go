@@ -19,6 +19,7 @@ type event struct {
 
 type metrics struct {
 	winnerCounts      map[string]int
+	reasonCounts      map[string]int
 	gameDurations     []float64
 	gamesPerDay       map[string]int
 	gamesPerHour      map[string]int
@@ -31,6 +32,7 @@ type metrics struct {
 func newMetrics() *metrics {
 	return &metrics{
 		winnerCounts:  make(map[string]int),
+		reasonCounts:  make(map[string]int),
 		gameDurations: make([]float64, 0),
 		gamesPerDay:   make(map[string]int),
 		gamesPerHour:  make(map[string]int),
@@ -51,6 +53,11 @@ func (m *metrics) recordGameFinished(payload map[string]any, timestamp time.Time
 		m.userWins[winner]++
 	}
 
+	// Track how games end
+	if reason, ok := payload["reason"].(string); ok && reason != "" {
+		m.reasonCounts[reason]++
+	}
+
 	// Track game duration
 	if duration, ok := payload["duration"].(float64); ok {
 		m.gameDurations = append(m.gameDurations, duration)
@@ -102,6 +109,7 @@ func (m *metrics) printStats() {
 	log.Printf("Total Games: %d", m.totalGames)
 	log.Printf("Average Game Duration: %.2f seconds", avgDuration)
 	log.Printf("Most Frequent Winners: %v", m.winnerCounts)
+	log.Printf("Game Endings: %v", m.reasonCounts)
 	log.Printf("Games Per Day (last 7 days): %v", m.gamesPerDay)
 	log.Printf("Games Per Hour (last 24 hours): %v", m.gamesPerHour)
 	log.Printf("User Game Counts: %v", m.userGames)
@@ -149,9 +157,10 @@ func main() {
 		}
 
 		// Log every event
-		log.Printf("event=%s gameId=%v winner=%v", e.Event,
+		log.Printf("event=%s gameId=%v winner=%v reason=%v", e.Event,
 			e.Payload["gameId"],
-			e.Payload["winner"])
+			e.Payload["winner"],
+			e.Payload["reason"])
 	}
 }
 
@@ -0,0 +1,48 @@
+// Command bookgen builds an opening book for the bot by searching every
+// position up to a fixed number of plies.
+//
+//	go run ./cmd/bookgen -plies 4 -depth 12 -out opening-book.txt
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"emittr/backend/internal/game"
+)
+
+func main() {
+	plies := flag.Int("plies", 4, "longest move sequence to include")
+	depth := flag.Int("depth", 12, "search depth used to score replies")
+	margin := flag.Int("margin", 4, "keep replies scoring within this much of the best")
+	tableSize := flag.Int("tt", 1<<22, "transposition table entries")
+	out := flag.String("out", "opening-book.txt", "output file")
+	flag.Parse()
+
+	start := time.Now()
+	book := game.GenerateOpeningBook(game.BookOptions{
+		Plies:  *plies,
+		Depth:  *depth,
+		Margin: *margin,
+		Table:  game.NewTranspositionTable(*tableSize),
+		Progress: func(done int) {
+			if done%100 == 0 {
+				log.Printf("scored %d positions (%s)", done, time.Since(start).Round(time.Second))
+			}
+		},
+	})
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := book.Write(f); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d positions to %s in %s", book.Len(), *out, time.Since(start).Round(time.Second))
+}
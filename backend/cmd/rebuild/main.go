@@ -0,0 +1,115 @@
+// Command rebuild replays the game event log and rebuilds every game from
+// it. It reports each game and can refill the games table and the
+// snapshots of the games in progress from the log.
+//
+//	go run ./cmd/rebuild -dir events/
+//	POSTGRES_URL=... go run ./cmd/rebuild -save -snapshots snapshots/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"emittr/backend/internal/game"
+	"emittr/backend/internal/server"
+	"emittr/backend/internal/storage"
+)
+
+func main() {
+	dir := flag.String("dir", "", "event log directory (default: the log in POSTGRES_URL)")
+	only := flag.String("game", "", "rebuild only this game")
+	save := flag.Bool("save", false, "save finished games to POSTGRES_URL")
+	snapshots := flag.String("snapshots", "", "write snapshots of games in progress to this directory")
+	flag.Parse()
+	ctx := context.Background()
+
+	var pg *storage.PostgresStore
+	if dsn := os.Getenv("POSTGRES_URL"); dsn != "" {
+		var err error
+		if pg, err = storage.NewPostgresStore(ctx, dsn); err != nil {
+			log.Fatal(err)
+		}
+		defer pg.Close(ctx)
+		if err := pg.EnsureTables(ctx); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var events storage.EventStore
+	switch {
+	case *dir != "":
+		files, err := storage.NewFileEventStore(*dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		events = files
+	case pg != nil:
+		events = pg
+	default:
+		log.Fatal("set -dir or POSTGRES_URL")
+	}
+	if *save && pg == nil {
+		log.Fatal("-save needs POSTGRES_URL")
+	}
+	var snaps *storage.FileSnapshotStore
+	if *snapshots != "" {
+		var err error
+		if snaps, err = storage.NewFileSnapshotStore(*snapshots); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ids := []string{*only}
+	if *only == "" {
+		var err error
+		if ids, err = events.EventGames(ctx); err != nil {
+			log.Fatal(err)
+		}
+	}
+	failed := 0
+	for _, id := range ids {
+		g, err := rebuild(ctx, events, id)
+		if err != nil {
+			log.Printf("game %s: %v", id, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s %s events=%d moves=%d winner=%q reason=%q %s\n",
+			g.ID, g.Status, g.Version(), len(g.Moves), g.Winner, g.Reason, game.FormatPosition(g.Board, g.Turn))
+		switch {
+		case g.Status == game.StatusFinished && *save:
+			if err := pg.SaveGame(ctx, server.CompletedGame(g)); err != nil {
+				log.Printf("game %s: %v", id, err)
+				failed++
+			}
+		case g.Status == game.StatusActive && snaps != nil:
+			data, err := json.Marshal(g.Snapshot())
+			if err == nil {
+				err = snaps.SaveSnapshot(ctx, g.ID, data)
+			}
+			if err != nil {
+				log.Printf("game %s: %v", id, err)
+				failed++
+			}
+		}
+	}
+	log.Printf("rebuilt %d of %d games", len(ids)-failed, len(ids))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func rebuild(ctx context.Context, events storage.EventStore, id string) (*game.GameState, error) {
+	docs, err := events.LoadEvents(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	evs, err := server.DecodeEvents(docs)
+	if err != nil {
+		return nil, err
+	}
+	return game.Rebuild(evs)
+}
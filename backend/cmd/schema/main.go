@@ -0,0 +1,29 @@
+// Command schema writes the JSON Schema of the websocket protocol, the
+// same document the server serves at /protocol/schema.
+//
+//	go run ./cmd/schema -out protocol.schema.json
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"emittr/backend/internal/protocol"
+)
+
+func main() {
+	out := flag.String("out", "", "output file; standard output if empty")
+	flag.Parse()
+
+	data := append(protocol.Schema(), '\n')
+	if *out == "" {
+		if _, err := os.Stdout.Write(data); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
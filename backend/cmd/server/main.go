@@ -4,11 +4,15 @@ import (
 	"context"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"emittr/backend/internal/analytics"
+	"emittr/backend/internal/game"
 	"emittr/backend/internal/server"
+	"emittr/backend/internal/solver"
 	"emittr/backend/internal/storage"
 )
 
@@ -22,9 +26,13 @@ func main() {
 		addr = getEnv("ADDR", ":8080")
 	}
 	botDelay := durationEnv("BOT_DELAY", 10*time.Second)
+	botMoveTimeout := durationEnv("BOT_MOVE_TIMEOUT", 3*time.Second)
 	reconnect := durationEnv("RECONNECT_WINDOW", 30*time.Second)
+	searchTableSize := intEnv("BOT_TT_SIZE", 1<<20)
+	sessionTTL := durationEnv("SESSION_TTL", server.DefaultSessionTTL)
 
 	var store storage.Store
+	var snapshots storage.SnapshotStore
 	if dsn := os.Getenv("POSTGRES_URL"); dsn != "" {
 		pg, err := storage.NewPostgresStore(context.Background(), dsn)
 		if err != nil {
@@ -34,6 +42,40 @@ func main() {
 				log.Printf("postgres ensure tables failed: %v", err)
 			}
 			store = pg
+			snapshots = pg
+		}
+	}
+	if dir := os.Getenv("SNAPSHOT_DIR"); dir != "" {
+		files, err := storage.NewFileSnapshotStore(dir)
+		if err != nil {
+			log.Printf("snapshot directory disabled: %v", err)
+		} else {
+			snapshots = files
+		}
+	}
+
+	if store == nil {
+		store = storage.NewMemoryStore()
+	}
+	events, _ := store.(storage.EventStore)
+	accounts, _ := store.(storage.AccountStore)
+	if dir := os.Getenv("EVENT_LOG_DIR"); dir != "" {
+		files, err := storage.NewFileEventStore(dir)
+		if err != nil {
+			log.Printf("event log directory disabled: %v", err)
+		} else {
+			events = files
+		}
+	}
+
+	var book *game.OpeningBook
+	if path := os.Getenv("OPENING_BOOK"); path != "" {
+		loaded, err := game.LoadOpeningBook(path)
+		if err != nil {
+			log.Printf("opening book disabled: %v", err)
+		} else {
+			log.Printf("opening book loaded: %d positions", loaded.Len())
+			book = loaded
 		}
 	}
 
@@ -45,14 +87,37 @@ func main() {
 
 	srv := server.New(server.Config{
 		BotFallbackAfter: botDelay,
+		BotMoveTimeout:   botMoveTimeout,
 		ReconnectWindow:  reconnect,
 		Store:            store,
 		Analytics:        producer,
+		SearchTableSize:  searchTableSize,
+		OpeningBook:      book,
+		Solver:           solver.New(searchTableSize),
+		Snapshots:        snapshots,
+		Events:           events,
+		SessionSecret:    os.Getenv("SESSION_SECRET"),
+		SessionTTL:       sessionTTL,
+		Accounts:         accounts,
 	})
 
-	log.Printf("server listening on %s", addr)
-	if err := srv.Run(addr); err != nil {
-		log.Fatal(err)
+	go func() {
+		log.Printf("server listening on %s", addr)
+		if err := srv.Run(addr); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	// Store what is still queued before exiting, so restored games and
+	// the event log agree.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	log.Printf("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %v", err)
 	}
 }
 
@@ -72,3 +137,11 @@ func durationEnv(key string, fallback time.Duration) time.Duration {
 	return fallback
 }
 
+func intEnv(key string, fallback int) int {
+	if v := os.Getenv(key); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
@@ -47,4 +47,3 @@ func (p *Producer) Close() {
 	}
 	_ = p.writer.Close()
 }
-
@@ -0,0 +1,293 @@
+package game
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// Bitboard layout: each column owns colBits consecutive bits, bottom cell
+// first. When the board leaves room, colBits is Rows+1 and the extra bit
+// is an always-empty sentinel on top of every column, as in the standard
+// 7x6 layout:
+//
+//	6 13 20 27 34 41 48
+//	5 12 19 26 33 40 47
+//	...
+//	0  7 14 21 28 35 42
+//
+// Larger boards pack the columns without sentinels. Line detection never
+// relies on them, it masks the cells a line may start from instead.
+type layout struct {
+	rules   Rules
+	colBits int
+	// sentinel reports whether every column has a spare bit on top.
+	sentinel bool
+	bottom   uint64
+	board    uint64
+	// shifts are the bit distances between neighbouring cells along the
+	// vertical, horizontal and both diagonal directions; starts holds the
+	// cells a line of rules.Connect fits from in each direction.
+	shifts [4]uint
+	starts [4]uint64
+	// lines holds every window of rules.Connect cells, used by the search
+	// heuristic to count discs per line with a single popcount.
+	lines  []uint64
+	center uint64
+	// order lists the columns by distance from the center.
+	order []int
+	// salt keeps the hashes of different rules apart.
+	salt uint64
+}
+
+var layouts sync.Map // Rules -> *layout
+
+func layoutFor(r Rules) *layout {
+	if l, ok := layouts.Load(r); ok {
+		return l.(*layout)
+	}
+	l, _ := layouts.LoadOrStore(r, newLayout(r))
+	return l.(*layout)
+}
+
+func newLayout(r Rules) *layout {
+	l := &layout{rules: r, colBits: r.Rows}
+	if (r.Rows+1)*r.Columns <= maxCells {
+		l.colBits = r.Rows + 1
+		l.sentinel = true
+	}
+	for col := 0; col < r.Columns; col++ {
+		l.bottom |= l.cell(col, 0)
+	}
+	l.board = l.bottom * ((1 << r.Rows) - 1)
+	if !l.sentinel {
+		l.board = 1<<(r.Columns*r.Rows) - 1
+	}
+	for h := 0; h < r.Rows; h++ {
+		l.center |= l.cell(r.Columns/2, h)
+	}
+
+	directions := [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+	for i, d := range directions {
+		l.shifts[i] = uint(d[0]*l.colBits + d[1])
+		for col := 0; col < r.Columns; col++ {
+			for h := 0; h < r.Rows; h++ {
+				endC, endH := col+(r.Connect-1)*d[0], h+(r.Connect-1)*d[1]
+				if endC < 0 || endC >= r.Columns || endH < 0 || endH >= r.Rows {
+					continue
+				}
+				l.starts[i] |= l.cell(col, h)
+				var m uint64
+				for k := 0; k < r.Connect; k++ {
+					m |= l.cell(col+k*d[0], h+k*d[1])
+				}
+				l.lines = append(l.lines, m)
+			}
+		}
+	}
+	center := r.Columns / 2
+	l.order = append(l.order, center)
+	for d := 1; len(l.order) < r.Columns; d++ {
+		if center-d >= 0 {
+			l.order = append(l.order, center-d)
+		}
+		if center+d < r.Columns {
+			l.order = append(l.order, center+d)
+		}
+	}
+
+	if r != StandardRules.geometry() {
+		l.salt = mix64(uint64(r.Columns)<<16 | uint64(r.Rows)<<8 | uint64(r.Connect))
+	}
+	return l
+}
+
+func (l *layout) cell(col, height int) uint64 {
+	return 1 << uint(col*l.colBits+height)
+}
+
+// hasLine reports whether mask holds rules.Connect aligned bits.
+func (l *layout) hasLine(mask uint64) bool {
+	for i, shift := range l.shifts {
+		m := mask & l.starts[i]
+		for k := 1; k < l.rules.Connect && m != 0; k++ {
+			m &= mask >> (uint(k) * shift)
+		}
+		if m != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Position is a bitboard view of a Board: one disc mask per player and the
+// current fill height of every column, plus the incrementally maintained
+// Zobrist hash. It is a value type, so copying a Position is as cheap as
+// copying the struct.
+type Position struct {
+	layout *layout
+	discs  [2]uint64
+	height [MaxColumns]int
+	moves  int
+	hash   uint64
+}
+
+// NewPosition converts a Board into its bitboard representation for a
+// game won by connect discs in a row.
+func NewPosition(b Board, connect int) Position {
+	l := layoutFor(Rules{Columns: b.Columns(), Rows: b.Rows(), Connect: connect})
+	p := Position{layout: l, hash: l.salt}
+	for col := 0; col < b.Columns(); col++ {
+		for row := b.Rows() - 1; row >= 0; row-- {
+			cell := b[row][col]
+			if cell == CellEmpty {
+				break
+			}
+			p.discs[cell-1] |= l.cell(col, p.height[col])
+			p.hash ^= l.zobrist(cell, col, p.height[col])
+			p.height[col]++
+			p.moves++
+		}
+	}
+	return p
+}
+
+// Rules returns the rules the position is played under.
+func (p *Position) Rules() Rules {
+	return p.layout.rules
+}
+
+// Columns returns the width of the board.
+func (p *Position) Columns() int {
+	return p.layout.rules.Columns
+}
+
+// Board converts the position back into the slice form used by the
+// server protocol.
+func (p Position) Board() Board {
+	r := p.layout.rules
+	b := r.NewBoard()
+	for col := 0; col < r.Columns; col++ {
+		for h := 0; h < p.height[col]; h++ {
+			bit := p.layout.cell(col, h)
+			switch {
+			case p.discs[0]&bit != 0:
+				b[r.Rows-1-h][col] = CellP1
+			case p.discs[1]&bit != 0:
+				b[r.Rows-1-h][col] = CellP2
+			}
+		}
+	}
+	return b
+}
+
+// CanPlay reports whether col is on the board and not full.
+func (p *Position) CanPlay(col int) bool {
+	return col >= 0 && col < p.layout.rules.Columns && p.height[col] < p.layout.rules.Rows
+}
+
+// Play drops a disc for player into col and returns the Board row it
+// landed on. The caller must check CanPlay first.
+func (p *Position) Play(col, player int) int {
+	h := p.height[col]
+	p.discs[player-1] |= p.layout.cell(col, h)
+	p.hash ^= p.layout.zobrist(player, col, h)
+	p.height[col]++
+	p.moves++
+	return p.layout.rules.Rows - 1 - h
+}
+
+// Undo removes the top disc of col, reverting the last Play there.
+func (p *Position) Undo(col int) {
+	p.height[col]--
+	p.moves--
+	h := p.height[col]
+	bit := p.layout.cell(col, h)
+	if p.discs[0]&bit != 0 {
+		p.hash ^= p.layout.zobrist(CellP1, col, h)
+	} else {
+		p.hash ^= p.layout.zobrist(CellP2, col, h)
+	}
+	p.discs[0] &^= bit
+	p.discs[1] &^= bit
+}
+
+// IsWinningMove reports whether dropping player's disc into col would
+// complete a winning line. The caller must check CanPlay first.
+func (p *Position) IsWinningMove(col, player int) bool {
+	return p.layout.hasLine(p.discs[player-1] | p.layout.cell(col, p.height[col]))
+}
+
+// HasWon reports whether player has a winning line on the board.
+func (p *Position) HasWon(player int) bool {
+	return p.layout.hasLine(p.discs[player-1])
+}
+
+// Discs returns the disc mask of player.
+func (p *Position) Discs(player int) uint64 {
+	return p.discs[player-1]
+}
+
+// Occupied returns the mask of all discs on the board.
+func (p *Position) Occupied() uint64 {
+	return p.discs[0] | p.discs[1]
+}
+
+// Height returns how many discs col holds.
+func (p *Position) Height(col int) int {
+	return p.height[col]
+}
+
+// Moves returns the number of discs on the board.
+func (p *Position) Moves() int {
+	return p.moves
+}
+
+// Full reports whether no column can take another disc.
+func (p *Position) Full() bool {
+	return p.moves == p.layout.rules.Rows*p.layout.rules.Columns
+}
+
+// Playable returns the mask of cells a disc can be dropped into now.
+func (p *Position) Playable() uint64 {
+	if p.layout.sentinel {
+		return (p.Occupied() + p.layout.bottom) & p.layout.board
+	}
+	var m uint64
+	for col := 0; col < p.layout.rules.Columns; col++ {
+		if p.height[col] < p.layout.rules.Rows {
+			m |= p.layout.cell(col, p.height[col])
+		}
+	}
+	return m
+}
+
+// WinningCells returns the empty cells that would complete a winning line
+// for player, whether or not they are playable yet.
+func (p *Position) WinningCells(player int) uint64 {
+	l := p.layout
+	own := p.discs[player-1]
+	var r uint64
+	for i, shift := range l.shifts {
+		// For every gap position j, find the lines whose other cells are
+		// all own discs and mark the gap.
+		for j := 0; j < l.rules.Connect; j++ {
+			m := l.starts[i]
+			for k := 0; k < l.rules.Connect && m != 0; k++ {
+				if k != j {
+					m &= own >> (uint(k) * shift)
+				}
+			}
+			r |= m << (uint(j) * shift)
+		}
+	}
+	return r & (l.board ^ p.Occupied())
+}
+
+// ColumnMask returns the mask of every playable cell in col.
+func (p *Position) ColumnMask(col int) uint64 {
+	return ((1 << p.layout.rules.Rows) - 1) << uint(col*p.layout.colBits)
+}
+
+func popcount(m uint64) int {
+	return bits.OnesCount64(m)
+}
@@ -1,10 +1,19 @@
 package game
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
+// Limits on the board size. A board must also fit the 64 bit bitboards
+// used by the bots, so Columns*Rows may not exceed 64.
 const (
-	Columns = 7
-	Rows    = 6
+	MinColumns = 4
+	MaxColumns = 10
+	MinRows    = 4
+	MaxRows    = 10
+	MinConnect = 3
+	maxCells   = 64
 )
 
 const (
@@ -18,76 +27,230 @@ var (
 	ErrInvalidTurn  = errors.New("not your turn")
 	ErrInvalidCol   = errors.New("invalid column")
 	ErrGameFinished = errors.New("game already finished")
+	ErrInvalidRules = errors.New("invalid board rules")
+	ErrInvalidMove  = errors.New("invalid move action")
+)
+
+// Variants.
+const (
+	VariantNormal = "normal"
+	// VariantPopOut also lets a player remove one of their own discs from
+	// the bottom of a column instead of dropping one.
+	VariantPopOut = "popout"
 )
 
-type Board [Rows][Columns]int
+// Action is the kind of a move: dropping a disc or, in PopOut, popping
+// one out.
+type Action string
+
+const (
+	ActionDrop Action = "drop"
+	ActionPop  Action = "pop"
+)
+
+// ParseAction maps a user supplied move action to an Action. An empty
+// string is a drop.
+func ParseAction(s string) (Action, error) {
+	switch Action(s) {
+	case "", ActionDrop:
+		return ActionDrop, nil
+	case ActionPop:
+		return ActionPop, nil
+	}
+	return "", ErrInvalidMove
+}
+
+// Rules are the parameters of a game: the board size, how many discs in
+// a row win and the variant.
+type Rules struct {
+	Columns int    `json:"columns"`
+	Rows    int    `json:"rows"`
+	Connect int    `json:"connect"`
+	Variant string `json:"variant"`
+}
+
+// StandardRules is the classic 7x6 board with four in a row to win.
+var StandardRules = Rules{Columns: 7, Rows: 6, Connect: 4, Variant: VariantNormal}
+
+// geometry returns the rules without the variant, which is all the
+// bitboards depend on.
+func (r Rules) geometry() Rules {
+	return Rules{Columns: r.Columns, Rows: r.Rows, Connect: r.Connect}
+}
+
+// Validate reports whether the rules describe a playable board.
+func (r Rules) Validate() error {
+	switch {
+	case r.Columns < MinColumns || r.Columns > MaxColumns:
+		return fmt.Errorf("%w: columns must be between %d and %d", ErrInvalidRules, MinColumns, MaxColumns)
+	case r.Rows < MinRows || r.Rows > MaxRows:
+		return fmt.Errorf("%w: rows must be between %d and %d", ErrInvalidRules, MinRows, MaxRows)
+	case r.Columns*r.Rows > maxCells:
+		return fmt.Errorf("%w: the board may have at most %d cells", ErrInvalidRules, maxCells)
+	case r.Connect < MinConnect || r.Connect > max(r.Columns, r.Rows):
+		return fmt.Errorf("%w: connect must be between %d and %d", ErrInvalidRules, MinConnect, max(r.Columns, r.Rows))
+	case r.Variant != VariantNormal && r.Variant != VariantPopOut:
+		return fmt.Errorf("%w: unknown variant %q", ErrInvalidRules, r.Variant)
+	}
+	return nil
+}
+
+// Play applies a move by player under the rules. Under PopOut a full
+// board is only a draw once the next player cannot move either, and a
+// pop may decide the game for either player; repetitions are left to the
+// caller, which knows the game's history.
+func (r Rules) Play(b Board, action Action, col, player int) (MoveResult, error) {
+	switch action {
+	case ActionDrop, "":
+		res, err := b.ApplyMove(col, player, r.Connect)
+		if err == nil && r.Variant == VariantPopOut && res.Winner == CellEmpty {
+			res.IsDraw = !r.CanMove(b, opponentOf(player))
+		}
+		return res, err
+	case ActionPop:
+		if r.Variant != VariantPopOut {
+			return MoveResult{}, ErrInvalidMove
+		}
+		res, err := b.PopMove(col, player, r.Connect)
+		if err == nil && res.Winner == CellEmpty {
+			res.IsDraw = !r.CanMove(b, opponentOf(player))
+		}
+		return res, err
+	}
+	return MoveResult{}, ErrInvalidMove
+}
+
+// CanMove reports whether player has any legal move on b.
+func (r Rules) CanMove(b Board, player int) bool {
+	bottom := b.Rows() - 1
+	for col := 0; col < b.Columns(); col++ {
+		if b[0][col] == CellEmpty {
+			return true
+		}
+		if r.Variant == VariantPopOut && b[bottom][col] == player {
+			return true
+		}
+	}
+	return false
+}
+
+// NewBoard returns an empty board of the rules' size.
+func (r Rules) NewBoard() Board {
+	b := make(Board, r.Rows)
+	cells := make([]int, r.Rows*r.Columns)
+	for row := range b {
+		b[row] = cells[row*r.Columns : (row+1)*r.Columns]
+	}
+	return b
+}
+
+// Board holds the cells row by row, top row first. Boards are slices, so
+// use CopyBoard to keep a snapshot.
+type Board [][]int
+
+// Columns returns the width of the board.
+func (b Board) Columns() int {
+	if len(b) == 0 {
+		return 0
+	}
+	return len(b[0])
+}
+
+// Rows returns the height of the board.
+func (b Board) Rows() int {
+	return len(b)
+}
 
 type MoveResult struct {
 	Board   Board
+	Action  Action
+	Row     int
+	Column  int
 	Winner  int
 	IsDraw  bool
 	Winning [][2]int
 }
 
-func (b *Board) ApplyMove(col int, player int) (MoveResult, error) {
-	if col < 0 || col >= Columns {
+// ApplyMove drops player's disc into col. connect is the number of discs
+// in a row that wins.
+func (b Board) ApplyMove(col, player, connect int) (MoveResult, error) {
+	if col < 0 || col >= b.Columns() {
 		return MoveResult{}, ErrInvalidCol
 	}
-	for row := Rows - 1; row >= 0; row-- {
+	for row := b.Rows() - 1; row >= 0; row-- {
 		if b[row][col] == CellEmpty {
 			b[row][col] = player
-			return evaluate(*b, row, col, player), nil
+			res := evaluate(b, row, col, player, connect)
+			res.Action, res.Row, res.Column = ActionDrop, row, col
+			return res, nil
 		}
 	}
 	return MoveResult{}, ErrColumnFull
 }
 
-func evaluate(board Board, row, col, player int) MoveResult {
-	directions := [][2]int{{1, 0}, {0, 1}, {1, 1}, {1, -1}}
-	for _, d := range directions {
-		coords := winningCoords(board, row, col, player, d[0], d[1])
-		if len(coords) >= 4 {
-			return MoveResult{Board: board, Winner: player, Winning: coords}
+func evaluate(board Board, row, col, player, connect int) MoveResult {
+	// The bitboard check is cheap; the coordinates of the winning line
+	// are only collected once a win is known to exist.
+	pos := NewPosition(board, connect)
+	if pos.HasWon(player) {
+		directions := [][2]int{{1, 0}, {0, 1}, {1, 1}, {1, -1}}
+		for _, d := range directions {
+			coords := winningCoords(board, row, col, player, d[0], d[1])
+			if len(coords) >= connect {
+				return MoveResult{Board: CopyBoard(board), Winner: player, Winning: coords}
+			}
 		}
 	}
 
 	isDraw := true
-	for c := 0; c < Columns; c++ {
+	for c := 0; c < board.Columns(); c++ {
 		if board[0][c] == CellEmpty {
 			isDraw = false
 			break
 		}
 	}
-	return MoveResult{Board: board, IsDraw: isDraw}
+	return MoveResult{Board: CopyBoard(board), IsDraw: isDraw}
 }
 
+// winningCoords collects the run of player's discs through (row, col)
+// along the direction (dx, dy).
 func winningCoords(board Board, row, col, player, dx, dy int) [][2]int {
 	coords := [][2]int{{row, col}}
-	check := func(r, c int) {
-		for r >= 0 && r < Rows && c >= 0 && c < Columns {
+	check := func(sx, sy int) {
+		r, c := row+sx, col+sy
+		for r >= 0 && r < board.Rows() && c >= 0 && c < board.Columns() {
 			if board[r][c] != player {
 				return
 			}
 			coords = append(coords, [2]int{r, c})
-			r += dx
-			c += dy
+			r += sx
+			c += sy
 		}
 	}
-	check(row+dx, col+dy)
-	check(row-dx, col-dy)
-	if len(coords) >= 4 {
-		return coords
+	check(dx, dy)
+	check(-dx, -dy)
+	return coords
+}
+
+// Replay plays moves on an empty board and returns the board after every
+// ply, starting with the empty board.
+func Replay(rules Rules, moves []MoveRecord) ([]Board, error) {
+	b := rules.NewBoard()
+	boards := make([]Board, 0, len(moves)+1)
+	boards = append(boards, CopyBoard(b))
+	for _, m := range moves {
+		if _, err := rules.Play(b, m.Action, m.Column, m.Slot); err != nil {
+			return nil, fmt.Errorf("move %d: %w", m.Number, err)
+		}
+		boards = append(boards, CopyBoard(b))
 	}
-	return [][2]int{}
+	return boards, nil
 }
 
 func CopyBoard(src Board) Board {
-	var dest Board
-	for r := 0; r < Rows; r++ {
-		for c := 0; c < Columns; c++ {
-			dest[r][c] = src[r][c]
-		}
+	dest := Rules{Columns: src.Columns(), Rows: src.Rows()}.NewBoard()
+	for r := range src {
+		copy(dest[r], src[r])
 	}
 	return dest
 }
-
@@ -0,0 +1,304 @@
+package game
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Opening book file format, one position per line:
+//
+//	# comment
+//	<sequence> <column>:<weight>[,<column>:<weight>...]
+//
+// The sequence lists the columns played from the empty board as 1-based
+// digits ("-" for the empty board itself) and the replies are weighted
+// 1-based columns, e.g. "44 3:2,4:5,5:2". Player 1 always moves first.
+// Books cover games under StandardRules only.
+const bookHeader = "# 4-in-a-row opening book v1"
+
+var ErrInvalidBook = errors.New("invalid opening book")
+
+// BookMove is a candidate reply and its relative selection weight.
+type BookMove struct {
+	Column int
+	Weight int
+}
+
+type bookLine struct {
+	sequence []int
+	moves    []BookMove
+}
+
+// OpeningBook holds weighted replies for early positions. Entries are
+// stored by move sequence but indexed by position key, so transpositions
+// of a known sequence are found too.
+type OpeningBook struct {
+	lines []bookLine
+	index map[uint64][]BookMove
+}
+
+func NewOpeningBook() *OpeningBook {
+	return &OpeningBook{index: make(map[uint64][]BookMove)}
+}
+
+// LoadOpeningBook reads a book file from disk.
+func LoadOpeningBook(path string) (*OpeningBook, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadOpeningBook(f)
+}
+
+// ReadOpeningBook parses the book format from r.
+func ReadOpeningBook(r io.Reader) (*OpeningBook, error) {
+	book := NewOpeningBook()
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: line %d: expected sequence and moves", ErrInvalidBook, lineNo)
+		}
+		seq, err := parseBookSequence(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidBook, lineNo, err)
+		}
+		moves, err := parseBookMoves(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidBook, lineNo, err)
+		}
+		if err := book.Add(seq, moves); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+// Add records the replies for the position reached by playing sequence
+// (0-based columns) from the empty board. A position already in the book
+// keeps its first entry.
+func (b *OpeningBook) Add(sequence []int, moves []BookMove) error {
+	pos, player, err := replaySequence(sequence)
+	if err != nil {
+		return err
+	}
+	for _, m := range moves {
+		if !pos.CanPlay(m.Column) || m.Weight < 1 {
+			return fmt.Errorf("%w: bad reply %d:%d", ErrInvalidBook, m.Column+1, m.Weight)
+		}
+	}
+	key := pos.Key(player)
+	if _, exists := b.index[key]; exists || len(moves) == 0 {
+		return nil
+	}
+	b.index[key] = moves
+	b.lines = append(b.lines, bookLine{sequence: append([]int(nil), sequence...), moves: moves})
+	return nil
+}
+
+// Len returns the number of positions in the book.
+func (b *OpeningBook) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.lines)
+}
+
+// Lookup returns the book replies for player to move on board, which is
+// assumed to be played under StandardRules.
+func (b *OpeningBook) Lookup(board Board, player int) ([]BookMove, bool) {
+	if b == nil || board.Columns() != StandardRules.Columns || board.Rows() != StandardRules.Rows {
+		return nil, false
+	}
+	pos := NewPosition(board, StandardRules.Connect)
+	moves, ok := b.index[pos.Key(player)]
+	return moves, ok
+}
+
+// Pick chooses a book reply at random, proportionally to the weights.
+func (b *OpeningBook) Pick(board Board, player int) (int, bool) {
+	moves, ok := b.Lookup(board, player)
+	if !ok {
+		return -1, false
+	}
+	total := 0
+	for _, m := range moves {
+		total += m.Weight
+	}
+	n := rand.Intn(total)
+	for _, m := range moves {
+		if n < m.Weight {
+			return m.Column, true
+		}
+		n -= m.Weight
+	}
+	return moves[len(moves)-1].Column, true
+}
+
+// Write serializes the book in file order.
+func (b *OpeningBook) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, bookHeader)
+	for _, line := range b.lines {
+		seq := "-"
+		if len(line.sequence) > 0 {
+			var sb strings.Builder
+			for _, col := range line.sequence {
+				sb.WriteByte(byte('1' + col))
+			}
+			seq = sb.String()
+		}
+		replies := make([]string, len(line.moves))
+		for i, m := range line.moves {
+			replies[i] = fmt.Sprintf("%d:%d", m.Column+1, m.Weight)
+		}
+		fmt.Fprintf(bw, "%s %s\n", seq, strings.Join(replies, ","))
+	}
+	return bw.Flush()
+}
+
+func parseBookSequence(s string) ([]int, error) {
+	if s == "-" {
+		return nil, nil
+	}
+	seq := make([]int, len(s))
+	for i, ch := range s {
+		col := int(ch - '1')
+		if col < 0 || col >= StandardRules.Columns {
+			return nil, fmt.Errorf("bad column %q", ch)
+		}
+		seq[i] = col
+	}
+	return seq, nil
+}
+
+func parseBookMoves(s string) ([]BookMove, error) {
+	var moves []BookMove
+	for _, part := range strings.Split(s, ",") {
+		colStr, weightStr, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("bad reply %q", part)
+		}
+		col, err := strconv.Atoi(colStr)
+		if err != nil {
+			return nil, fmt.Errorf("bad reply %q", part)
+		}
+		weight, err := strconv.Atoi(weightStr)
+		if err != nil {
+			return nil, fmt.Errorf("bad reply %q", part)
+		}
+		moves = append(moves, BookMove{Column: col - 1, Weight: weight})
+	}
+	return moves, nil
+}
+
+// replaySequence plays sequence from the empty board and returns the
+// resulting position and the player to move.
+func replaySequence(sequence []int) (Position, int, error) {
+	pos := NewPosition(StandardRules.NewBoard(), StandardRules.Connect)
+	player := CellP1
+	for _, col := range sequence {
+		if !pos.CanPlay(col) {
+			return Position{}, 0, fmt.Errorf("%w: column %d is not playable", ErrInvalidBook, col+1)
+		}
+		if pos.IsWinningMove(col, player) {
+			return Position{}, 0, fmt.Errorf("%w: sequence ends the game", ErrInvalidBook)
+		}
+		pos.Play(col, player)
+		player = opponentOf(player)
+	}
+	return pos, player, nil
+}
+
+// BookOptions controls opening book generation.
+type BookOptions struct {
+	// Plies is the length of the longest sequence given an entry.
+	Plies int
+	// Depth is the search depth used to score every candidate reply.
+	Depth int
+	// Margin is how far below the best score a reply may fall and still
+	// be kept; closer replies get proportionally more weight.
+	Margin int
+	Table  *TranspositionTable
+	// Progress, if set, is called after every position is scored.
+	Progress func(done int)
+}
+
+// GenerateOpeningBook scores every position reachable within opts.Plies
+// moves with a deep search and keeps the replies near the best one.
+func GenerateOpeningBook(opts BookOptions) *OpeningBook {
+	book := NewOpeningBook()
+	done := 0
+	var walk func(seq []int, pos *Position, player int)
+	walk = func(seq []int, pos *Position, player int) {
+		if len(seq) > opts.Plies || pos.Full() {
+			return
+		}
+		if _, seen := book.index[pos.Key(player)]; seen {
+			return
+		}
+		moves := bookReplies(pos, player, opts)
+		_ = book.Add(seq, moves)
+		done++
+		if opts.Progress != nil {
+			opts.Progress(done)
+		}
+		for _, col := range pos.layout.order {
+			if !pos.CanPlay(col) || pos.IsWinningMove(col, player) {
+				continue
+			}
+			pos.Play(col, player)
+			walk(append(seq, col), pos, opponentOf(player))
+			pos.Undo(col)
+		}
+	}
+	root := NewPosition(StandardRules.NewBoard(), StandardRules.Connect)
+	walk(nil, &root, CellP1)
+	return book
+}
+
+func bookReplies(pos *Position, player int, opts BookOptions) []BookMove {
+	var scores [MaxColumns]int
+	best := -infScore
+	search := &searcher{ctx: context.Background(), tt: opts.Table}
+	for _, col := range pos.layout.order {
+		if !pos.CanPlay(col) {
+			continue
+		}
+		if pos.IsWinningMove(col, player) {
+			scores[col] = winScore - 1
+		} else {
+			pos.Play(col, player)
+			scores[col] = -search.negamax(pos, opponentOf(player), opts.Depth-1, 1, -infScore, infScore)
+			pos.Undo(col)
+		}
+		best = max(best, scores[col])
+	}
+	var moves []BookMove
+	for col := 0; col < pos.Columns(); col++ {
+		if !pos.CanPlay(col) {
+			continue
+		}
+		if gap := best - scores[col]; gap <= opts.Margin {
+			moves = append(moves, BookMove{Column: col, Weight: opts.Margin - gap + 1})
+		}
+	}
+	return moves
+}
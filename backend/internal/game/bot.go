@@ -1,66 +1,124 @@
 package game
 
 import (
-	"math/rand"
+	"context"
+	"strconv"
 	"time"
 )
 
-// Bot is a simple but competitive opponent that tries to win,
-// then block, then favor center columns.
+// maxSolveTime bounds the solver's attempt at a move of a perfect bot
+// without a deadline.
+const maxSolveTime = 3 * time.Second
+
+// Bot is the search based computer opponent. It plays from its opening
+// book while the position is covered and otherwise searches the game
+// tree to its Difficulty's depth, or as deep as the deadline allows. The
+// book is only consulted under StandardRules. At DifficultyPerfect the
+// Solver, when set, gets the first half of the time to prove the best
+// move, and the search falls back on the rest if it cannot.
 type Bot struct {
+	Player     int
+	Difficulty Difficulty
+	Rules      Rules
+	Table      *TranspositionTable
+	Book       *OpeningBook
+	Solver     Solver
+}
+
+func NewBot(player int, difficulty Difficulty) *Bot {
+	return &Bot{Player: player, Difficulty: difficulty, Rules: StandardRules}
+}
+
+func (b *Bot) Name() string {
+	return StrategyMinimax
+}
+
+func (b *Bot) Metadata() map[string]string {
+	return map[string]string{
+		"difficulty":  string(b.Difficulty),
+		"depth":       strconv.Itoa(b.Difficulty.Depth()),
+		"openingBook": strconv.FormatBool(b.Book.Len() > 0),
+		"solver":      strconv.FormatBool(b.solves()),
+	}
+}
+
+func (b *Bot) solves() bool {
+	return b.Difficulty == DifficultyPerfect && b.Solver != nil && b.Rules == StandardRules
+}
+
+func (b *Bot) ChooseMove(ctx context.Context, board Board) (int, error) {
+	if b.Rules == StandardRules {
+		if col, ok := b.Book.Pick(board, b.Player); ok {
+			return col, nil
+		}
+	}
+	if b.solves() {
+		budget := maxSolveTime
+		if deadline, ok := ctx.Deadline(); ok {
+			budget = time.Until(deadline) / 2
+		}
+		solveCtx, cancel := context.WithTimeout(ctx, budget)
+		col, ok := b.Solver.BestMove(solveCtx, board, b.Player)
+		cancel()
+		if ok {
+			return col, nil
+		}
+	}
+	col, _ := SearchContext(ctx, board, b.Rules.Connect, b.Player, b.Difficulty.Depth(), b.Table)
+	if col < 0 {
+		return -1, ErrNoMove
+	}
+	return col, nil
+}
+
+// ClassicBot is a simple but competitive opponent that tries to win,
+// then block, then favor center columns.
+type ClassicBot struct {
 	Player int
+	Rules  Rules
 }
 
-func NewBot(player int) *Bot {
-	return &Bot{Player: player}
+func NewClassicBot(player int) *ClassicBot {
+	return &ClassicBot{Player: player, Rules: StandardRules}
 }
 
-func (b *Bot) ChooseMove(board Board) int {
-	rand.Seed(time.Now().UnixNano())
+func (b *ClassicBot) Name() string {
+	return StrategyClassic
+}
 
+func (b *ClassicBot) Metadata() map[string]string {
+	return map[string]string{}
+}
+
+func (b *ClassicBot) ChooseMove(ctx context.Context, board Board) (int, error) {
+	pos := NewPosition(board, b.Rules.Connect)
 	// 1. Take winning move if available.
-	if move, ok := findImmediate(board, b.Player); ok {
-		return move
+	if move, ok := findImmediate(&pos, b.Player); ok {
+		return move, nil
 	}
 	// 2. Block opponent winning move.
 	opponent := CellP1
 	if b.Player == CellP1 {
 		opponent = CellP2
 	}
-	if move, ok := findImmediate(board, opponent); ok {
-		return move
+	if move, ok := findImmediate(&pos, opponent); ok {
+		return move, nil
 	}
 
 	// 3. Prefer center columns to build threats.
-	preferred := []int{3, 2, 4, 1, 5, 0, 6}
-	for _, col := range preferred {
-		if canPlay(board, col) {
-			return col
-		}
-	}
-	// 4. Fallback first available column.
-	for col := 0; col < Columns; col++ {
-		if canPlay(board, col) {
-			return col
+	for _, col := range pos.layout.order {
+		if pos.CanPlay(col) {
+			return col, nil
 		}
 	}
-	return 0
+	return -1, ErrNoMove
 }
 
-func findImmediate(board Board, player int) (int, bool) {
-	for col := 0; col < Columns; col++ {
-		if !canPlay(board, col) {
-			continue
-		}
-		tmp := CopyBoard(board)
-		if res, _ := tmp.ApplyMove(col, player); res.Winner == player {
+func findImmediate(pos *Position, player int) (int, bool) {
+	for col := 0; col < pos.Columns(); col++ {
+		if pos.CanPlay(col) && pos.IsWinningMove(col, player) {
 			return col, true
 		}
 	}
 	return -1, false
 }
-
-func canPlay(board Board, col int) bool {
-	return board[0][col] == CellEmpty
-}
-
@@ -0,0 +1,187 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxBaseTime bounds the starting budget of a time control.
+const MaxBaseTime = 3 * time.Hour
+
+var ErrInvalidTimeControl = errors.New("invalid time control")
+
+// TimeControl is a per-player time budget plus an increment added after
+// every move, written like in chess as minutes+seconds ("2+1"). The zero
+// value means an untimed game.
+type TimeControl struct {
+	Base      time.Duration
+	Increment time.Duration
+}
+
+// ParseTimeControl reads a "minutes+seconds" time control. An empty
+// string is an untimed game.
+func ParseTimeControl(s string) (TimeControl, error) {
+	if s == "" {
+		return TimeControl{}, nil
+	}
+	base, inc, ok := strings.Cut(s, "+")
+	if !ok {
+		return TimeControl{}, fmt.Errorf("%w: %q, want minutes+seconds", ErrInvalidTimeControl, s)
+	}
+	minutes, err1 := strconv.ParseFloat(base, 64)
+	seconds, err2 := strconv.ParseFloat(inc, 64)
+	if err1 != nil || err2 != nil {
+		return TimeControl{}, fmt.Errorf("%w: %q, want minutes+seconds", ErrInvalidTimeControl, s)
+	}
+	tc := TimeControl{
+		Base:      time.Duration(minutes * float64(time.Minute)),
+		Increment: time.Duration(seconds * float64(time.Second)),
+	}
+	if tc.Base <= 0 || tc.Base > MaxBaseTime || tc.Increment < 0 || tc.Increment > time.Minute {
+		return TimeControl{}, fmt.Errorf("%w: %q", ErrInvalidTimeControl, s)
+	}
+	return tc, nil
+}
+
+// Timed reports whether games under tc have clocks.
+func (tc TimeControl) Timed() bool {
+	return tc.Base > 0
+}
+
+func (tc TimeControl) String() string {
+	if !tc.Timed() {
+		return ""
+	}
+	minutes := strconv.FormatFloat(tc.Base.Minutes(), 'f', -1, 64)
+	seconds := strconv.FormatFloat(tc.Increment.Seconds(), 'f', -1, 64)
+	return minutes + "+" + seconds
+}
+
+func (tc TimeControl) MarshalText() ([]byte, error) {
+	return []byte(tc.String()), nil
+}
+
+func (tc *TimeControl) UnmarshalText(text []byte) error {
+	parsed, err := ParseTimeControl(string(text))
+	if err != nil {
+		return err
+	}
+	*tc = parsed
+	return nil
+}
+
+// Clock keeps both players' remaining time. Only the clock of the player
+// to move runs; Press stops it, adds the increment and starts the
+// opponent's.
+type Clock struct {
+	Control   TimeControl
+	remaining [2]time.Duration
+	running   int
+	since     time.Time
+}
+
+// NewClock starts a clock for tc with player's time running.
+func NewClock(tc TimeControl, player int, now time.Time) *Clock {
+	return &Clock{
+		Control:   tc,
+		remaining: [2]time.Duration{tc.Base, tc.Base},
+		running:   player,
+		since:     now,
+	}
+}
+
+// Remaining returns player's time left at now, never below zero.
+func (c *Clock) Remaining(player int, now time.Time) time.Duration {
+	left := c.remaining[player-1]
+	if c.running == player {
+		left -= now.Sub(c.since)
+	}
+	return max(left, 0)
+}
+
+// Press ends the turn of the running player at now.
+func (c *Clock) Press(now time.Time) {
+	if c.running == 0 {
+		return
+	}
+	c.remaining[c.running-1] = c.Remaining(c.running, now) + c.Control.Increment
+	c.running = opponentOf(c.running)
+	c.since = now
+}
+
+// Stop freezes both clocks at now.
+func (c *Clock) Stop(now time.Time) {
+	if c.running == 0 {
+		return
+	}
+	c.remaining[c.running-1] = c.Remaining(c.running, now)
+	c.running = 0
+}
+
+// Flagged returns the player whose time has run out at now, or 0.
+func (c *Clock) Flagged(now time.Time) int {
+	if c.running != 0 && c.Remaining(c.running, now) == 0 {
+		return c.running
+	}
+	return 0
+}
+
+// ClockState is a clock as sent to clients, with times in milliseconds.
+type ClockState struct {
+	Control   TimeControl   `json:"control"`
+	Remaining map[int]int64 `json:"remaining"`
+	// Running is the slot whose time is running, 0 once the game is over.
+	Running int `json:"running"`
+}
+
+// State returns the clock as seen at now.
+func (c *Clock) State(now time.Time) ClockState {
+	return ClockState{
+		Control: c.Control,
+		Remaining: map[int]int64{
+			CellP1: c.Remaining(CellP1, now).Milliseconds(),
+			CellP2: c.Remaining(CellP2, now).Milliseconds(),
+		},
+		Running: c.running,
+	}
+}
+
+// scheduleFlagLocked arms the timer that ends g when the player to move
+// runs out of time.
+func (m *Manager) scheduleFlagLocked(g *GameState) {
+	if g.flag != nil {
+		g.flag.Stop()
+	}
+	left := g.Clock.Remaining(g.Turn, time.Now())
+	id := g.ID
+	g.flag = time.AfterFunc(left, func() { m.checkClock(id) })
+}
+
+func (m *Manager) checkClock(gameID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, ok := m.games[gameID]
+	if !ok || g.Status != StatusActive || g.Clock == nil {
+		return
+	}
+	now := time.Now()
+	if g.Clock.Flagged(now) == 0 {
+		m.scheduleFlagLocked(g)
+		return
+	}
+	m.flagLocked(g, now)
+}
+
+// flagLocked ends g as lost on time by the player to move.
+func (m *Manager) flagLocked(g *GameState, now time.Time) {
+	var winner string
+	for name, p := range g.Players {
+		if p.Slot != g.Turn {
+			winner = name
+		}
+	}
+	m.finishLocked(g, winner, ReasonTimeout, now)
+}
@@ -0,0 +1,93 @@
+package game
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoDrawOffer   = errors.New("no draw offer to answer")
+	ErrBotNeverDraws = errors.New("the bot does not accept draws")
+)
+
+// Resign ends gameID as a win for username's opponent.
+func (m *Manager) Resign(gameID, username string) (*GameState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, err := m.activePlayerGameLocked(gameID, username)
+	if err != nil {
+		return nil, err
+	}
+	m.finishLocked(g, g.opponent(username).Username, ReasonResignation, time.Now())
+	return g, nil
+}
+
+// OfferDraw offers username's opponent a draw. The offer stands until the
+// opponent answers it or makes a move. If the opponent has an offer of
+// their own pending, the two agree and the game ends drawn.
+func (m *Manager) OfferDraw(gameID, username string) (*GameState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, err := m.activePlayerGameLocked(gameID, username)
+	if err != nil {
+		return nil, err
+	}
+	opponent := g.opponent(username)
+	if opponent.IsBot {
+		return nil, ErrBotNeverDraws
+	}
+	if g.drawOffer == opponent.Username {
+		m.finishLocked(g, "", ReasonDrawAgreed, time.Now())
+		return g, nil
+	}
+	if err := m.recordLocked(g, Event{Type: EventDrawOffered, Player: username}); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// AcceptDraw agrees to the opponent's draw offer and ends gameID drawn.
+func (m *Manager) AcceptDraw(gameID, username string) (*GameState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, err := m.activePlayerGameLocked(gameID, username)
+	if err != nil {
+		return nil, err
+	}
+	if g.drawOffer == "" || g.drawOffer == username {
+		return nil, ErrNoDrawOffer
+	}
+	m.finishLocked(g, "", ReasonDrawAgreed, time.Now())
+	return g, nil
+}
+
+// DeclineDraw turns down the opponent's draw offer.
+func (m *Manager) DeclineDraw(gameID, username string) (*GameState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, err := m.activePlayerGameLocked(gameID, username)
+	if err != nil {
+		return nil, err
+	}
+	if g.drawOffer == "" || g.drawOffer == username {
+		return nil, ErrNoDrawOffer
+	}
+	if err := m.recordLocked(g, Event{Type: EventDrawDeclined, Player: username}); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (m *Manager) activePlayerGameLocked(gameID, username string) (*GameState, error) {
+	g, ok := m.games[gameID]
+	if !ok {
+		return nil, ErrGameNotFound
+	}
+	if p, ok := g.Players[username]; !ok || p.IsBot {
+		return nil, ErrNotInGame
+	}
+	if g.Status == StatusFinished {
+		return nil, ErrGameFinished
+	}
+	return g, nil
+}
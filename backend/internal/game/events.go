@@ -0,0 +1,418 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Every change to a game is recorded as an Event before it takes effect:
+// the manager appends the event to the game's log and applies it to the
+// GameState, so replaying the log with Rebuild always reproduces the
+// state. Events only record what happened; validating a request happens
+// before its event is created.
+
+// EventType names the kind of an Event.
+type EventType string
+
+const (
+	EventGameCreated EventType = "game_created"
+	// EventGameRestored reloads a game from a snapshot after a restart.
+	// Time from the snapshot to the event counts neither on the clocks nor
+	// against the reconnect window.
+	EventGameRestored       EventType = "game_restored"
+	EventMovePlayed         EventType = "move_played"
+	EventDrawOffered        EventType = "draw_offered"
+	EventDrawDeclined       EventType = "draw_declined"
+	EventPlayerDisconnected EventType = "player_disconnected"
+	EventPlayerReconnected  EventType = "player_reconnected"
+	EventGameFinished       EventType = "game_finished"
+	EventRematchOffered     EventType = "rematch_offered"
+	EventRematchDeclined    EventType = "rematch_declined"
+	EventRematchStarted     EventType = "rematch_started"
+)
+
+var (
+	ErrEventOutOfOrder = errors.New("event out of order")
+	ErrInvalidEvent    = errors.New("invalid event")
+)
+
+// Event is one entry in the log of a game. Only the field matching Type
+// is set among Created, Restored, Move and Finished; Player names the
+// player behind draw, rematch and connection events and Next the game a
+// rematch started.
+type Event struct {
+	GameID string `json:"gameId"`
+	// Seq numbers the events of a game from 1 without gaps.
+	Seq  int       `json:"seq"`
+	Type EventType `json:"type"`
+	At   time.Time `json:"at"`
+
+	Created  *GameCreated  `json:"created,omitempty"`
+	Restored *Snapshot     `json:"restored,omitempty"`
+	Move     *MovePlayed   `json:"move,omitempty"`
+	Finished *GameFinished `json:"finished,omitempty"`
+	Player   string        `json:"player,omitempty"`
+	Next     string        `json:"next,omitempty"`
+}
+
+// GameCreated starts a game. Slot 1 moves first.
+type GameCreated struct {
+	Room        string      `json:"room,omitempty"`
+	Rules       Rules       `json:"rules"`
+	Players     []Player    `json:"players"`
+	Bot         *BotConfig  `json:"bot,omitempty"`
+	TimeControl TimeControl `json:"timeControl"`
+	// Series is the score of the earlier games when the game is a
+	// rematch.
+	Series Series `json:"series"`
+}
+
+// MovePlayed is a legal move. Final is set when the move ends the game,
+// in which case the turn does not pass and a GameFinished follows.
+type MovePlayed struct {
+	Action Action `json:"action"`
+	Column int    `json:"column"`
+	Row    int    `json:"row"`
+	Slot   int    `json:"slot"`
+	Final  bool   `json:"final,omitempty"`
+}
+
+// GameFinished ends a game; Winner is empty for a draw.
+type GameFinished struct {
+	Winner string    `json:"winner,omitempty"`
+	Reason EndReason `json:"reason"`
+}
+
+// Version returns the Seq of the last event applied to g.
+func (g *GameState) Version() int {
+	return g.version
+}
+
+// Rebuild replays the log of a game, oldest event first.
+func Rebuild(events []Event) (*GameState, error) {
+	if len(events) == 0 {
+		return nil, fmt.Errorf("%w: empty log", ErrInvalidEvent)
+	}
+	g := &GameState{ID: events[0].GameID}
+	for _, e := range events {
+		if err := g.Apply(e); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Apply advances g by e. It fails without changing g when e does not
+// follow the events applied so far. The bot strategy and the flag timer
+// are not part of the log; the manager attaches them.
+func (g *GameState) Apply(e Event) error {
+	if e.GameID != g.ID {
+		return fmt.Errorf("%w: event of game %s applied to %s", ErrInvalidEvent, e.GameID, g.ID)
+	}
+	switch {
+	case e.Type == EventGameRestored:
+		// A checkpoint may follow any event, or start the log.
+		if e.Seq <= g.version {
+			return fmt.Errorf("%w: restore %d after %d", ErrEventOutOfOrder, e.Seq, g.version)
+		}
+	case e.Seq != g.version+1:
+		return fmt.Errorf("%w: %s %d after %d", ErrEventOutOfOrder, e.Type, e.Seq, g.version)
+	case (e.Type == EventGameCreated) != (g.version == 0):
+		return fmt.Errorf("%w: %s at %d", ErrEventOutOfOrder, e.Type, e.Seq)
+	}
+
+	var err error
+	switch e.Type {
+	case EventGameCreated:
+		err = g.applyCreated(e)
+	case EventGameRestored:
+		err = g.applyRestored(e)
+	case EventMovePlayed:
+		err = g.applyMove(e)
+	case EventDrawOffered:
+		if err = g.requireStatus(StatusActive); err == nil {
+			g.drawOffer = e.Player
+		}
+	case EventDrawDeclined:
+		if err = g.requireStatus(StatusActive); err == nil {
+			g.drawOffer = ""
+		}
+	case EventPlayerDisconnected:
+		if err = g.requireHuman(e.Player); err == nil {
+			if g.away == nil {
+				g.away = make(map[string]time.Time)
+			}
+			g.away[e.Player] = e.At
+		}
+	case EventPlayerReconnected:
+		if err = g.requireHuman(e.Player); err == nil {
+			delete(g.away, e.Player)
+		}
+	case EventGameFinished:
+		err = g.applyFinished(e)
+	case EventRematchOffered:
+		if err = g.requireStatus(StatusFinished); err == nil {
+			g.rematchOffer = e.Player
+		}
+	case EventRematchDeclined:
+		if err = g.requireStatus(StatusFinished); err == nil {
+			g.rematchOffer = ""
+		}
+	case EventRematchStarted:
+		if err = g.requireStatus(StatusFinished); err == nil {
+			g.next, g.rematchOffer = e.Next, ""
+		}
+	default:
+		err = fmt.Errorf("%w: unknown type %q", ErrInvalidEvent, e.Type)
+	}
+	if err != nil {
+		return err
+	}
+	g.version, g.changedAt = e.Seq, e.At
+	return nil
+}
+
+func (g *GameState) requireStatus(status string) error {
+	if g.Status != status {
+		return fmt.Errorf("%w: game is %s", ErrInvalidEvent, g.Status)
+	}
+	return nil
+}
+
+// requireHuman checks that the game is active and username one of its
+// human players.
+func (g *GameState) requireHuman(username string) error {
+	if err := g.requireStatus(StatusActive); err != nil {
+		return err
+	}
+	if p, ok := g.Players[username]; !ok || p.IsBot {
+		return fmt.Errorf("%w: %q is not a player of the game", ErrInvalidEvent, username)
+	}
+	return nil
+}
+
+func (g *GameState) applyCreated(e Event) error {
+	c := e.Created
+	if c == nil || len(c.Players) != 2 {
+		return fmt.Errorf("%w: game_created without players", ErrInvalidEvent)
+	}
+	if err := c.Rules.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	g.Room = c.Room
+	g.Rules = c.Rules
+	g.Board = c.Rules.NewBoard()
+	g.Status = StatusActive
+	g.Turn = CellP1
+	g.StartedAt = e.At
+	g.LastMoveAt = e.At
+	g.Series = c.Series
+	g.Players = make(map[string]*Player, len(c.Players))
+	for _, p := range c.Players {
+		p := p
+		g.Players[p.Username] = &p
+	}
+	if c.Bot != nil {
+		g.botConfig = *c.Bot
+	}
+	if c.TimeControl.Timed() {
+		g.Clock = NewClock(c.TimeControl, CellP1, e.At)
+	}
+	return nil
+}
+
+func (g *GameState) applyRestored(e Event) error {
+	s := e.Restored
+	if s == nil || s.ID != g.ID {
+		return fmt.Errorf("%w: game_restored without a snapshot of the game", ErrInvalidEvent)
+	}
+	g.Room = s.Room
+	g.Rules = s.Rules
+	g.Board = CopyBoard(s.Board)
+	g.Status = s.Status
+	g.Winner = s.Winner
+	g.Reason = s.Reason
+	g.StartedAt = s.StartedAt
+	g.EndedAt = s.EndedAt
+	g.Turn = s.Turn
+	g.LastMoveAt = e.At
+	g.Moves = append([]MoveRecord(nil), s.Moves...)
+	g.Series = s.Series
+	g.Players = make(map[string]*Player, len(s.Players))
+	for _, p := range s.Players {
+		p := p
+		g.Players[p.Username] = &p
+	}
+	g.botConfig = BotConfig{}
+	if s.Bot != nil {
+		g.botConfig = *s.Bot
+	}
+	g.Clock = nil
+	if c := s.Clock; c != nil {
+		g.Clock = &Clock{Control: c.Control, remaining: c.Remaining, running: c.Running, since: e.At}
+	}
+	g.seen = nil
+	if len(s.Seen) > 0 {
+		g.seen = make(map[uint64]int, len(s.Seen))
+		for k, v := range s.Seen {
+			g.seen[k] = v
+		}
+	}
+	// Nobody is connected after a restart, so the reconnect window of
+	// every player starts over.
+	g.away = make(map[string]time.Time, len(g.Players))
+	for name, p := range g.Players {
+		if !p.IsBot {
+			g.away[name] = e.At
+		}
+	}
+	g.drawOffer, g.rematchOffer, g.next = "", "", ""
+	return nil
+}
+
+func (g *GameState) applyMove(e Event) error {
+	mv := e.Move
+	if mv == nil {
+		return fmt.Errorf("%w: move_played without a move", ErrInvalidEvent)
+	}
+	if err := g.requireStatus(StatusActive); err != nil {
+		return err
+	}
+	if mv.Slot != g.Turn {
+		return fmt.Errorf("%w: slot %d moved on the turn of %d", ErrInvalidEvent, mv.Slot, g.Turn)
+	}
+	board := CopyBoard(g.Board)
+	res, err := g.Rules.Play(board, mv.Action, mv.Column, mv.Slot)
+	if err != nil {
+		return fmt.Errorf("%w: move %d: %v", ErrInvalidEvent, len(g.Moves)+1, err)
+	}
+	g.Board = board
+	g.LastMoveAt = e.At
+	g.Moves = append(g.Moves, MoveRecord{
+		Number:   len(g.Moves) + 1,
+		Action:   res.Action,
+		Column:   res.Column,
+		Row:      res.Row,
+		Slot:     mv.Slot,
+		PlayedAt: e.At,
+	})
+	if g.Rules.Variant == VariantPopOut && res.Winner == 0 && !res.IsDraw {
+		g.repeated(opponentOf(mv.Slot))
+	}
+	if mover := g.playerAt(mv.Slot); mover == nil || g.drawOffer != mover.Username {
+		// Moving declines the opponent's offer.
+		g.drawOffer = ""
+	}
+	if !mv.Final {
+		g.Turn = opponentOf(g.Turn)
+		if g.Clock != nil {
+			g.Clock.Press(e.At)
+		}
+	}
+	return nil
+}
+
+func (g *GameState) applyFinished(e Event) error {
+	if e.Finished == nil {
+		return fmt.Errorf("%w: game_finished without a result", ErrInvalidEvent)
+	}
+	if err := g.requireStatus(StatusActive); err != nil {
+		return err
+	}
+	g.Status = StatusFinished
+	g.Winner = e.Finished.Winner
+	g.Reason = e.Finished.Reason
+	g.EndedAt = e.At
+	g.drawOffer = ""
+	if g.Clock != nil {
+		g.Clock.Stop(e.At)
+	}
+	return nil
+}
+
+func (g *GameState) playerAt(slot int) *Player {
+	for _, p := range g.Players {
+		if p.Slot == slot {
+			return p
+		}
+	}
+	return nil
+}
+
+// recordLocked stamps e as the next event of g, applies it and hands it
+// to the event and snapshot hooks. A restore keeps the Seq it is given,
+// which continues the game's log.
+func (m *Manager) recordLocked(g *GameState, e Event) error {
+	e.GameID = g.ID
+	if e.Type != EventGameRestored {
+		e.Seq = g.version + 1
+	}
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	// Drop the monotonic reading, which the log does not keep, so the
+	// live game and its rebuilt copy compute the same clock times.
+	e.At = e.At.Round(0)
+	if err := g.Apply(e); err != nil {
+		return err
+	}
+	if m.onEvent != nil {
+		m.onEvent(e)
+	}
+	m.changedLocked(g)
+	return nil
+}
+
+// createGameLocked starts a game from c, seating its players and arming
+// its clock.
+func (m *Manager) createGameLocked(c GameCreated) (*GameState, error) {
+	var bot Strategy
+	for _, p := range c.Players {
+		if !p.IsBot {
+			continue
+		}
+		if c.Bot == nil {
+			return nil, fmt.Errorf("%w: bot without a configuration", ErrInvalidEvent)
+		}
+		var err error
+		if bot, err = m.newBotLocked(c.Rules, p.Slot, *c.Bot); err != nil {
+			return nil, err
+		}
+	}
+	g := &GameState{ID: uuid.NewString()}
+	if err := m.recordLocked(g, Event{Type: EventGameCreated, Created: &c}); err != nil {
+		return nil, err
+	}
+	m.attachLocked(g, bot)
+	return g, nil
+}
+
+func (m *Manager) newBotLocked(rules Rules, slot int, cfg BotConfig) (Strategy, error) {
+	return NewStrategy(cfg.Strategy, StrategyOptions{
+		Player:     slot,
+		Difficulty: cfg.Difficulty,
+		Rules:      rules,
+		Seed:       time.Now().UnixNano(),
+		Table:      m.table,
+		Book:       m.book,
+		Solver:     m.solver,
+	})
+}
+
+// attachLocked registers a game built from events with the manager: it
+// gives the game its bot, maps the players to it and arms the flag.
+func (m *Manager) attachLocked(g *GameState, bot Strategy) {
+	g.Bot = bot
+	m.games[g.ID] = g
+	for name, p := range g.Players {
+		if !p.IsBot {
+			m.userToGame[name] = g.ID
+		}
+	}
+	if g.Status == StatusActive && g.Clock != nil {
+		m.scheduleFlagLocked(g)
+	}
+}
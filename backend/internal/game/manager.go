@@ -2,10 +2,9 @@ package game
 
 import (
 	"log"
+	"sort"
 	"sync"
 	"time"
-
-	"github.com/google/uuid"
 )
 
 const (
@@ -14,50 +13,145 @@ const (
 	StatusFinished = "finished"
 )
 
+// EndReason says how a finished game ended.
+type EndReason string
+
+const (
+	// ReasonConnect is a win by completing a line.
+	ReasonConnect EndReason = "connect"
+	// ReasonFullBoard is a draw on a board where the player to move has
+	// no move left.
+	ReasonFullBoard EndReason = "full_board"
+	// ReasonRepetition is a PopOut draw by threefold repetition.
+	ReasonRepetition  EndReason = "repetition"
+	ReasonTimeout     EndReason = "timeout"
+	ReasonResignation EndReason = "resignation"
+	ReasonDrawAgreed  EndReason = "agreed_draw"
+	// ReasonForfeit is a loss by staying away past the reconnect window.
+	ReasonForfeit EndReason = "forfeit"
+)
+
 type GameState struct {
-	ID         string
-	Board      Board
-	Status     string
-	Winner     string
+	ID string
+	// Room is the invite code of the private room the game started from.
+	Room   string
+	Rules  Rules
+	Board  Board
+	Status string
+	Winner string
+	// Reason says how a finished game ended.
+	Reason     EndReason
 	StartedAt  time.Time
 	EndedAt    time.Time
 	Turn       int
 	LastMoveAt time.Time
 	Players    map[string]*Player
-	Bot        *Bot
+	Bot        Strategy
+	Moves      []MoveRecord
+	// Clock is nil in untimed games.
+	Clock *Clock
+	// Series is the score of the earlier games in a run of rematches.
+	Series Series
+	// seen counts the PopOut positions reached so far by Position.Key.
+	seen map[uint64]int
+	// away holds when each disconnected player left.
+	away map[string]time.Time
+	// drawOffer is the player whose draw offer is pending.
+	drawOffer string
+	// rematchOffer is the player waiting for the opponent to accept a
+	// rematch; next is the ID of the rematch once it started.
+	rematchOffer string
+	next         string
+	botConfig    BotConfig
+	// version is the Seq of the last event applied and changedAt its time.
+	version   int
+	changedAt time.Time
+	// flag fires when the player to move runs out of time.
+	flag *time.Timer
+}
+
+// MoveRecord is one applied move in the order it was played.
+type MoveRecord struct {
+	Number   int       `json:"number"`
+	Action   Action    `json:"action"`
+	Column   int       `json:"column"`
+	Row      int       `json:"row"`
+	Slot     int       `json:"slot"`
+	PlayedAt time.Time `json:"playedAt"`
+}
+
+// BotConfig selects the strategy and strength of the bot in a bot game.
+type BotConfig struct {
+	Strategy   string     `json:"strategy"`
+	Difficulty Difficulty `json:"difficulty"`
 }
 
 type Player struct {
-	Username string
-	Slot     int
-	IsBot    bool
+	Username string `json:"username"`
+	Slot     int    `json:"slot"`
+	IsBot    bool   `json:"isBot,omitempty"`
 }
 
 type Manager struct {
 	mu             sync.RWMutex
-	waiting        *Player
+	queue          []*queued // waiting players, longest waiting first
+	rooms          map[string]*Room
 	games          map[string]*GameState
 	userToGame     map[string]string
 	reconnectAfter time.Duration
-	onFinish       func(*GameState)
+	onEvent        func(Event)
+	snapshotter    func(Snapshot)
+	table          *TranspositionTable
+	book           *OpeningBook
+	solver         Solver
 }
 
 type Move struct {
 	Username string
 	GameID   string
+	Action   Action
 	Column   int
 }
 
-func NewManager(reconnectWindow time.Duration, onFinish func(*GameState)) *Manager {
+// NewManager creates a manager that passes every event it records to
+// onEvent, in order and with its lock held.
+func NewManager(reconnectWindow time.Duration, onEvent func(Event)) *Manager {
 	return &Manager{
+		rooms:          make(map[string]*Room),
 		games:          make(map[string]*GameState),
 		userToGame:     make(map[string]string),
 		reconnectAfter: reconnectWindow,
-		onFinish:       onFinish,
+		onEvent:        onEvent,
 	}
 }
 
-func (m *Manager) AssignPlayer(username string) (*GameState, *Player, bool) {
+// SetTranspositionTable shares tt with the search of every bot created
+// from now on. A nil table disables caching.
+func (m *Manager) SetTranspositionTable(tt *TranspositionTable) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.table = tt
+}
+
+// SetOpeningBook gives every bot created from now on book. A nil book
+// leaves openings to the search.
+func (m *Manager) SetOpeningBook(book *OpeningBook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.book = book
+}
+
+// SetSolver lets the perfect level of every bot created from now on
+// solve positions with solver. A nil solver leaves them to the search.
+func (m *Manager) SetSolver(solver Solver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.solver = solver
+}
+
+// AssignPlayer pairs username with the closest rated player waiting for
+// the same game within the match window, or queues them.
+func (m *Manager) AssignPlayer(username string, seek Seek) (*GameState, *Player, bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -69,59 +163,46 @@ func (m *Manager) AssignPlayer(username string) (*GameState, *Player, bool) {
 		}
 	}
 
-	player := &Player{Username: username, Slot: CellP1}
-	if m.waiting == nil {
-		m.waiting = player
-		return nil, player, true
+	// A second connection replaces the first one's place in the queue.
+	m.dequeueLocked(username)
+	now := time.Now()
+	player := &queued{player: &Player{Username: username, Slot: CellP1}, seek: seek, since: now}
+	i := m.closestLocked(player, now)
+	if i < 0 {
+		m.queue = append(m.queue, player)
+		return nil, player.player, true
 	}
 
 	// Start new game.
-	opponent := m.waiting
-	m.waiting = nil
-	game := &GameState{
-		ID:        uuid.NewString(),
-		Status:    StatusActive,
-		Turn:      CellP1,
-		StartedAt: time.Now(),
-		LastMoveAt: time.Now(),
-		Players: map[string]*Player{
-			opponent.Username: opponent,
-			player.Username:   {Username: username, Slot: CellP2},
-		},
+	opponent := m.queue[i]
+	m.dequeueLocked(opponent.player.Username)
+	game, err := m.startMatchLocked(opponent, player)
+	if err != nil {
+		m.queue = append(m.queue, player)
+		return nil, player.player, true
 	}
-	m.games[game.ID] = game
-	m.userToGame[player.Username] = game.ID
-	m.userToGame[opponent.Username] = game.ID
 	return game, game.Players[username], false
 }
 
-func (m *Manager) StartBotGame(human string) *GameState {
+func (m *Manager) StartBotGame(human string, rules Rules, tc TimeControl, cfg BotConfig) (*GameState, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if gid, ok := m.userToGame[human]; ok {
 		if g, exists := m.games[gid]; exists && g.Status != StatusFinished {
-			return g
+			return g, nil
 		}
 	}
 
-	humanPlayer := &Player{Username: human, Slot: CellP1}
-	bot := NewBot(CellP2)
-	game := &GameState{
-		ID:        uuid.NewString(),
-		Status:    StatusActive,
-		Turn:      CellP1,
-		StartedAt: time.Now(),
-		LastMoveAt: time.Now(),
-		Players: map[string]*Player{
-			human: humanPlayer,
-			"bot": {Username: "bot", Slot: CellP2, IsBot: true},
+	return m.createGameLocked(GameCreated{
+		Rules: rules,
+		Players: []Player{
+			{Username: human, Slot: CellP1},
+			{Username: "bot", Slot: CellP2, IsBot: true},
 		},
-		Bot: bot,
-	}
-	m.games[game.ID] = game
-	m.userToGame[human] = game.ID
-	return game
+		Bot:         &cfg,
+		TimeControl: tc,
+	})
 }
 
 func (m *Manager) HandleMove(move Move) (MoveResult, *GameState, error) {
@@ -142,34 +223,72 @@ func (m *Manager) HandleMove(move Move) (MoveResult, *GameState, error) {
 	if game.Turn != player.Slot {
 		return MoveResult{}, game, ErrInvalidTurn
 	}
-	res, err := game.Board.ApplyMove(move.Column, player.Slot)
+	now := time.Now()
+	if game.Clock != nil && game.Clock.Flagged(now) != 0 {
+		m.flagLocked(game, now)
+		return MoveResult{}, game, ErrGameFinished
+	}
+	// Try the move on a copy; the event applies it.
+	res, err := game.Rules.Play(CopyBoard(game.Board), move.Action, move.Column, player.Slot)
+	if err != nil {
+		return MoveResult{}, game, err
+	}
+	drawReason := ReasonFullBoard
+	if game.Rules.Variant == VariantPopOut && res.Winner == 0 && !res.IsDraw && game.wouldRepeat(res.Board, opponentOf(player.Slot)) {
+		res.IsDraw, drawReason = true, ReasonRepetition
+	}
+	err = m.recordLocked(game, Event{Type: EventMovePlayed, At: now, Move: &MovePlayed{
+		Action: res.Action,
+		Column: res.Column,
+		Row:    res.Row,
+		Slot:   player.Slot,
+		Final:  res.Winner != 0 || res.IsDraw,
+	}})
 	if err != nil {
 		return MoveResult{}, game, err
 	}
-	game.LastMoveAt = time.Now()
 	if res.Winner != 0 {
-		game.Status = StatusFinished
-		game.Winner = move.Username
-		game.EndedAt = time.Now()
-		if m.onFinish != nil {
-			go m.onFinish(game)
-		}
+		// res.Winner is the slot whose line is complete; after a pop that
+		// completes both lines PopMove has already given it to the popper.
+		m.finishLocked(game, game.playerAt(res.Winner).Username, ReasonConnect, now)
 	} else if res.IsDraw {
-		game.Status = StatusFinished
-		game.EndedAt = time.Now()
-		if m.onFinish != nil {
-			go m.onFinish(game)
-		}
-	} else {
-		if game.Turn == CellP1 {
-			game.Turn = CellP2
-		} else {
-			game.Turn = CellP1
-		}
+		m.finishLocked(game, "", drawReason, now)
+	} else if game.Clock != nil {
+		m.scheduleFlagLocked(game)
 	}
 	return res, game, nil
 }
 
+// finishLocked ends game at now with winner, empty for a draw.
+func (m *Manager) finishLocked(game *GameState, winner string, reason EndReason, now time.Time) {
+	if game.flag != nil {
+		game.flag.Stop()
+	}
+	err := m.recordLocked(game, Event{Type: EventGameFinished, At: now, Finished: &GameFinished{Winner: winner, Reason: reason}})
+	if err != nil {
+		log.Printf("cannot finish game %s: %v", game.ID, err)
+	}
+}
+
+// repeated records the current position with toMove to play and reports
+// whether it has now occurred RepetitionLimit times.
+func (g *GameState) repeated(toMove int) bool {
+	if g.seen == nil {
+		g.seen = make(map[uint64]int)
+	}
+	pos := NewPosition(g.Board, g.Rules.Connect)
+	key := pos.Key(toMove)
+	g.seen[key]++
+	return g.seen[key] >= RepetitionLimit
+}
+
+// wouldRepeat reports whether reaching b with toMove to play would make
+// its position occur RepetitionLimit times.
+func (g *GameState) wouldRepeat(b Board, toMove int) bool {
+	pos := NewPosition(b, g.Rules.Connect)
+	return g.seen[pos.Key(toMove)]+1 >= RepetitionLimit
+}
+
 func (m *Manager) GetGame(gameID string) (*GameState, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -203,48 +322,80 @@ func (m *Manager) Abandon(username string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	delete(m.userToGame, username)
-	if m.waiting != nil && m.waiting.Username == username {
-		m.waiting = nil
-	}
+	m.dequeueLocked(username)
 }
 
-// MarkDisconnected updates last seen time so sweeper can forfeit
-// after the reconnect window.
+// MarkDisconnected records that username left their game, so the
+// sweeper can forfeit it for them after the reconnect window.
 func (m *Manager) MarkDisconnected(username string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if id, ok := m.userToGame[username]; ok {
-		if g, exists := m.games[id]; exists {
-			g.LastMoveAt = time.Now()
+		if g, exists := m.games[id]; exists && g.Status == StatusActive {
+			if err := m.recordLocked(g, Event{Type: EventPlayerDisconnected, Player: username}); err != nil {
+				log.Printf("cannot record disconnect in game %s: %v", id, err)
+			}
 		}
 	}
 }
 
-// Forfeit stale games past reconnect window.
-func (m *Manager) SweepDisconnects() {
+// MarkReconnected records that username is back in the game they left,
+// stopping their reconnect window.
+func (m *Manager) MarkReconnected(username string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	now := time.Now()
-	for id, g := range m.games {
-		if g.Status != StatusFinished && now.Sub(g.LastMoveAt) > m.reconnectAfter {
-			g.Status = StatusFinished
-			g.Winner = findRemainingPlayer(g)
-			g.EndedAt = now
-			if m.onFinish != nil {
-				go m.onFinish(g)
+	if id, ok := m.userToGame[username]; ok {
+		if g, exists := m.games[id]; exists && g.Status == StatusActive {
+			if _, left := g.away[username]; !left {
+				return
+			}
+			if err := m.recordLocked(g, Event{Type: EventPlayerReconnected, Player: username}); err != nil {
+				log.Printf("cannot record reconnect in game %s: %v", id, err)
 			}
-			log.Printf("game %s forfeited due to timeout", id)
 		}
 	}
 }
 
-func findRemainingPlayer(g *GameState) string {
-	for name, p := range g.Players {
-		if p.IsBot {
+// Forfeit games whose players stayed away past the reconnect window and
+// close expired rooms.
+func (m *Manager) SweepDisconnects() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.expireRoomsLocked(now)
+	for id, g := range m.games {
+		// Timed games end on the clock instead.
+		if g.Status != StatusActive || g.Clock != nil {
 			continue
 		}
-		return name
+		if loser, winner, ok := g.forfeit(now, m.reconnectAfter); ok {
+			m.finishLocked(g, winner, ReasonForfeit, now)
+			log.Printf("game %s forfeited by %s after disconnect", id, loser)
+		}
 	}
-	return "bot"
 }
 
+// forfeit returns a player who has been away longer than window, and the
+// winner: their opponent, or nobody if the opponent has been away that
+// long too.
+func (g *GameState) forfeit(now time.Time, window time.Duration) (loser, winner string, ok bool) {
+	var gone []string
+	for name, at := range g.away {
+		if now.Sub(at) > window {
+			gone = append(gone, name)
+		}
+	}
+	switch len(gone) {
+	case 0:
+		return "", "", false
+	case 1:
+		for name := range g.Players {
+			if name != gone[0] {
+				winner = name
+			}
+		}
+		return gone[0], winner, true
+	}
+	sort.Strings(gone)
+	return gone[0], "", true
+}
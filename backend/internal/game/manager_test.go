@@ -0,0 +1,49 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPopCompletingOnlyOpponentsLine(t *testing.T) {
+	m := NewManager(time.Minute, nil)
+	rules := Rules{Columns: 7, Rows: 6, Connect: 4, Variant: VariantPopOut}
+	room, err := m.CreateRoom("alice", rules, TimeControl{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := m.JoinRoom(room.Code, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := g.playerAt(CellP1).Username, g.playerAt(CellP2).Username
+
+	// The second player gets three in a row one above the bottom, next to
+	// the first player's discs in column 0; popping the bottom of column 0
+	// drops the second player's disc into the gap.
+	moves := []struct {
+		player string
+		action Action
+		col    int
+	}{
+		{first, ActionDrop, 0}, {second, ActionDrop, 3},
+		{first, ActionDrop, 1}, {second, ActionDrop, 1},
+		{first, ActionDrop, 2}, {second, ActionDrop, 2},
+		{first, ActionDrop, 0}, {second, ActionDrop, 3},
+		{first, ActionDrop, 6}, {second, ActionDrop, 0},
+		{first, ActionPop, 0},
+	}
+	var res MoveResult
+	for i, mv := range moves {
+		res, g, err = m.HandleMove(Move{Username: mv.player, GameID: g.ID, Action: mv.action, Column: mv.col})
+		if err != nil {
+			t.Fatalf("move %d: %v", i+1, err)
+		}
+	}
+	if res.Winner != CellP2 {
+		t.Fatalf("winning slot = %d, want %d", res.Winner, CellP2)
+	}
+	if g.Status != StatusFinished || g.Winner != second || g.Reason != ReasonConnect {
+		t.Fatalf("game ended %s, winner %q by %s; want finished, %q by %s", g.Status, g.Winner, g.Reason, second, ReasonConnect)
+	}
+}
@@ -0,0 +1,136 @@
+package game
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+// Two waiting players are paired when their ratings are at most the
+// match window of the one who has waited longer apart. The window starts
+// at MatchWindowBase rating points and widens by MatchWindowGrowth every
+// second, up to MatchWindowMax.
+const (
+	MatchWindowBase   = 100.0
+	MatchWindowGrowth = 25.0
+	MatchWindowMax    = 1000.0
+)
+
+// Seek is what a player asks matchmaking for. Only players seeking the
+// same rules and time control are paired.
+type Seek struct {
+	Rules       Rules
+	TimeControl TimeControl
+	Rating      float64
+}
+
+type queued struct {
+	player *Player
+	seek   Seek
+	since  time.Time
+}
+
+// MatchWindow returns how far apart in rating a player who has waited
+// for waited accepts an opponent.
+func MatchWindow(waited time.Duration) float64 {
+	return math.Min(MatchWindowBase+MatchWindowGrowth*waited.Seconds(), MatchWindowMax)
+}
+
+// matches reports whether a and b can play each other at now, and how far
+// apart their ratings are.
+func matches(a, b *queued, now time.Time) (float64, bool) {
+	if a.player.Username == b.player.Username || a.seek.Rules != b.seek.Rules || a.seek.TimeControl != b.seek.TimeControl {
+		return 0, false
+	}
+	gap := math.Abs(a.seek.Rating - b.seek.Rating)
+	waited := now.Sub(a.since)
+	if w := now.Sub(b.since); w > waited {
+		waited = w
+	}
+	return gap, gap <= MatchWindow(waited)
+}
+
+// closestLocked returns the index of the queued player p is best paired
+// with, the closest in rating, or -1.
+func (m *Manager) closestLocked(p *queued, now time.Time) int {
+	best, bestGap := -1, math.Inf(1)
+	for i, q := range m.queue {
+		if q == p {
+			continue
+		}
+		if gap, ok := matches(p, q, now); ok && gap < bestGap {
+			best, bestGap = i, gap
+		}
+	}
+	return best
+}
+
+// MatchQueue pairs the waiting players whose match windows have widened
+// enough since they joined the queue, longest waiting first, and returns
+// the games it started.
+func (m *Manager) MatchQueue() []*GameState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var started []*GameState
+	for i := 0; i < len(m.queue); {
+		p := m.queue[i]
+		j := m.closestLocked(p, now)
+		if j < 0 {
+			i++
+			continue
+		}
+		q := m.queue[j]
+		m.dequeueLocked(p.player.Username)
+		m.dequeueLocked(q.player.Username)
+		if g, err := m.startMatchLocked(p, q); err == nil {
+			started = append(started, g)
+		}
+		// The pair may have sat on either side of i, so the entries
+		// after it have shifted; scan again from the longest waiting.
+		i = 0
+	}
+	return started
+}
+
+// LeaveQueue takes username out of matchmaking and reports whether they
+// were still waiting.
+func (m *Manager) LeaveQueue(username string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dequeueLocked(username)
+}
+
+// QueueLength returns the number of players waiting for an opponent.
+func (m *Manager) QueueLength() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.queue)
+}
+
+func (m *Manager) dequeueLocked(username string) bool {
+	for i, q := range m.queue {
+		if q.player.Username == username {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// startMatchLocked starts the game between host, who waited longer and
+// moves first, and guest.
+func (m *Manager) startMatchLocked(host, guest *queued) (*GameState, error) {
+	game, err := m.createGameLocked(GameCreated{
+		Rules: host.seek.Rules,
+		Players: []Player{
+			{Username: host.player.Username, Slot: CellP1},
+			{Username: guest.player.Username, Slot: CellP2},
+		},
+		TimeControl: host.seek.TimeControl,
+	})
+	if err != nil {
+		log.Printf("cannot start game between %s and %s: %v", host.player.Username, guest.player.Username, err)
+	}
+	return game, err
+}
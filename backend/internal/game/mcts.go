@@ -0,0 +1,229 @@
+package game
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// Rollout selects how MCTS plays out a position to the end.
+type Rollout int
+
+const (
+	// RolloutRandom drops discs uniformly at random.
+	RolloutRandom Rollout = iota
+	// RolloutHeuristic takes an immediate win or blocks one when it can
+	// and otherwise plays at random.
+	RolloutHeuristic
+)
+
+var mctsIterations = map[Difficulty]int{
+	DifficultyEasy:    400,
+	DifficultyMedium:  4000,
+	DifficultyHard:    20000,
+	DifficultyPerfect: 60000,
+}
+
+// uctExploration is the exploration constant of the UCT formula.
+const uctExploration = 1.41
+
+// MCTSBot chooses moves with Monte Carlo Tree Search. It plays a looser,
+// more speculative game than the negamax Bot since it judges moves by
+// the outcome of playouts rather than a static evaluation. A MCTSBot is
+// not safe for concurrent use.
+type MCTSBot struct {
+	Player int
+	Rules  Rules
+	// Iterations caps the number of playouts per move.
+	Iterations int
+	// Budget, if positive, also caps the time spent per move.
+	Budget  time.Duration
+	Rollout Rollout
+	rng     *rand.Rand
+}
+
+// NewMCTSBot creates a bot whose playout count follows difficulty. Two
+// bots built with the same seed play identical games.
+func NewMCTSBot(player int, difficulty Difficulty, seed int64) *MCTSBot {
+	iterations, ok := mctsIterations[difficulty]
+	if !ok {
+		iterations = mctsIterations[DefaultDifficulty]
+	}
+	return &MCTSBot{
+		Player:     player,
+		Rules:      StandardRules,
+		Iterations: iterations,
+		Rollout:    RolloutHeuristic,
+		rng:        rand.New(rand.NewSource(seed)),
+	}
+}
+
+type mctsNode struct {
+	parent   *mctsNode
+	children []*mctsNode
+	untried  []int
+	col      int
+	// player made the move leading here; wins are counted for them.
+	player int
+	winner int
+	visits int
+	wins   float64
+}
+
+func (b *MCTSBot) Name() string {
+	return StrategyMCTS
+}
+
+func (b *MCTSBot) Metadata() map[string]string {
+	rollout := "random"
+	if b.Rollout == RolloutHeuristic {
+		rollout = "heuristic"
+	}
+	return map[string]string{
+		"iterations": strconv.Itoa(b.Iterations),
+		"budget":     b.Budget.String(),
+		"rollout":    rollout,
+	}
+}
+
+func (b *MCTSBot) ChooseMove(ctx context.Context, board Board) (int, error) {
+	pos := NewPosition(board, b.Rules.Connect)
+	for _, col := range pos.layout.order {
+		if pos.CanPlay(col) && pos.IsWinningMove(col, b.Player) {
+			return col, nil
+		}
+	}
+
+	root := &mctsNode{col: -1, player: opponentOf(b.Player)}
+	root.untried = legalMoves(&pos)
+	if len(root.untried) == 0 {
+		return -1, ErrNoMove
+	}
+	if b.Budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.Budget)
+		defer cancel()
+	}
+	// Always run at least one playout so the root has a child to pick.
+	for i := 0; i < max(b.Iterations, 1); i++ {
+		if i > 0 && i&63 == 0 && ctx.Err() != nil {
+			break
+		}
+		b.iterate(root, pos)
+	}
+
+	best := root.children[0]
+	for _, child := range root.children[1:] {
+		if child.visits > best.visits {
+			best = child
+		}
+	}
+	return best.col, nil
+}
+
+// iterate runs one select, expand, simulate and backpropagate cycle on a
+// scratch copy of pos.
+func (b *MCTSBot) iterate(root *mctsNode, pos Position) {
+	node := root
+	for len(node.untried) == 0 && len(node.children) > 0 {
+		node = node.selectChild()
+		pos.Play(node.col, node.player)
+	}
+	if len(node.untried) > 0 && node.winner == CellEmpty {
+		i := b.rng.Intn(len(node.untried))
+		col := node.untried[i]
+		node.untried[i] = node.untried[len(node.untried)-1]
+		node.untried = node.untried[:len(node.untried)-1]
+
+		player := opponentOf(node.player)
+		child := &mctsNode{parent: node, col: col, player: player}
+		if pos.IsWinningMove(col, player) {
+			child.winner = player
+		}
+		pos.Play(col, player)
+		if child.winner == CellEmpty {
+			child.untried = legalMoves(&pos)
+		}
+		node.children = append(node.children, child)
+		node = child
+	}
+
+	winner := node.winner
+	if winner == CellEmpty {
+		winner = b.simulate(&pos, opponentOf(node.player))
+	}
+	for n := node; n != nil; n = n.parent {
+		n.visits++
+		switch winner {
+		case n.player:
+			n.wins++
+		case CellEmpty:
+			n.wins += 0.5
+		}
+	}
+}
+
+func (n *mctsNode) selectChild() *mctsNode {
+	logVisits := math.Log(float64(n.visits))
+	var best *mctsNode
+	bestValue := math.Inf(-1)
+	for _, child := range n.children {
+		value := child.wins/float64(child.visits) + uctExploration*math.Sqrt(logVisits/float64(child.visits))
+		if value > bestValue {
+			best, bestValue = child, value
+		}
+	}
+	return best
+}
+
+// simulate plays pos out with player to move and returns the winner, or
+// CellEmpty for a draw.
+func (b *MCTSBot) simulate(pos *Position, player int) int {
+	var moves [MaxColumns]int
+	for !pos.Full() {
+		n := 0
+		for col := 0; col < pos.Columns(); col++ {
+			if pos.CanPlay(col) {
+				moves[n] = col
+				n++
+			}
+		}
+		col := moves[b.rng.Intn(n)]
+		if b.Rollout == RolloutHeuristic {
+			col = heuristicRolloutMove(pos, player, moves[:n], col)
+		}
+		if pos.IsWinningMove(col, player) {
+			return player
+		}
+		pos.Play(col, player)
+		player = opponentOf(player)
+	}
+	return CellEmpty
+}
+
+func heuristicRolloutMove(pos *Position, player int, moves []int, fallback int) int {
+	for _, col := range moves {
+		if pos.IsWinningMove(col, player) {
+			return col
+		}
+	}
+	opponent := opponentOf(player)
+	for _, col := range moves {
+		if pos.IsWinningMove(col, opponent) {
+			return col
+		}
+	}
+	return fallback
+}
+
+func legalMoves(pos *Position) []int {
+	moves := make([]int, 0, pos.Columns())
+	for _, col := range pos.layout.order {
+		if pos.CanPlay(col) {
+			moves = append(moves, col)
+		}
+	}
+	return moves
+}
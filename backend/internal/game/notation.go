@@ -0,0 +1,372 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Game notation, modelled on chess PGN: a block of tag pairs followed by
+// the numbered move list, 1-based column numbers, ending in the result.
+//
+//	[Event "4 in a Row"]
+//	[Date "2024.01.31"]
+//	[Red "alice"]
+//	[Yellow "bob"]
+//	[Result "1-0"]
+//
+//	1. 4 4 2. 5 3 3. 6 2 4. 7 1-0
+//
+// Red is the first player (slot 1), Yellow the second. Games under other
+// than StandardRules add a Size tag ("9x7", columns by rows), a Connect
+// tag with the winning line length and a Variant tag. PopOut pops are
+// written with a "p" before the column, e.g. "p4".
+
+const (
+	ResultRedWins    = "1-0"
+	ResultYellowWins = "0-1"
+	ResultDraw       = "1/2-1/2"
+	ResultUnfinished = "*"
+)
+
+var (
+	ErrInvalidNotation = errors.New("invalid game notation")
+	ErrInvalidPosition = errors.New("invalid position string")
+)
+
+// tagOrder lists the tags written first, in this order; any other tags
+// follow alphabetically.
+var tagOrder = []string{"Event", "Site", "Date", "Red", "Yellow", "Result", "Size", "Connect", "Variant"}
+
+// GameRecord is a game in notation form. Only the Action and Column of
+// the moves are written; ParseRecord fills in the rest. A zero Rules
+// means StandardRules.
+type GameRecord struct {
+	Tags   map[string]string
+	Rules  Rules
+	Moves  []MoveRecord
+	Result string
+}
+
+func (r GameRecord) rules() Rules {
+	if r.Rules == (Rules{}) {
+		return StandardRules
+	}
+	return r.Rules
+}
+
+// String serializes the record in game notation.
+func (r GameRecord) String() string {
+	var sb strings.Builder
+	result := r.Result
+	if result == "" {
+		result = ResultUnfinished
+	}
+	tags := make(map[string]string, len(r.Tags)+1)
+	for k, v := range r.Tags {
+		tags[k] = v
+	}
+	tags["Result"] = result
+	delete(tags, "Size")
+	delete(tags, "Connect")
+	delete(tags, "Variant")
+	if rules := r.rules(); rules != StandardRules {
+		tags["Size"] = fmt.Sprintf("%dx%d", rules.Columns, rules.Rows)
+		tags["Connect"] = strconv.Itoa(rules.Connect)
+		tags["Variant"] = rules.Variant
+	}
+
+	written := make(map[string]bool)
+	for _, k := range tagOrder {
+		if v, ok := tags[k]; ok {
+			writeTag(&sb, k, v)
+			written[k] = true
+		}
+	}
+	rest := make([]string, 0, len(tags))
+	for k := range tags {
+		if !written[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	for _, k := range rest {
+		writeTag(&sb, k, tags[k])
+	}
+
+	sb.WriteByte('\n')
+	for i, m := range r.Moves {
+		if i%2 == 0 {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			fmt.Fprintf(&sb, "%d.", i/2+1)
+		}
+		sb.WriteByte(' ')
+		if m.Action == ActionPop {
+			sb.WriteByte('p')
+		}
+		sb.WriteString(strconv.Itoa(m.Column + 1))
+	}
+	if len(r.Moves) > 0 {
+		sb.WriteByte(' ')
+	}
+	sb.WriteString(result)
+	sb.WriteByte('\n')
+	return sb.String()
+}
+
+func writeTag(sb *strings.Builder, key, value string) {
+	fmt.Fprintf(sb, "[%s %q]\n", key, value)
+}
+
+// ParseRecord reads a game in notation form and checks that every move is
+// legal and that no move follows a win.
+func ParseRecord(text string) (GameRecord, error) {
+	rec := GameRecord{Tags: make(map[string]string)}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	i := 0
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "[") {
+			break
+		}
+		key, value, err := parseTag(line)
+		if err != nil {
+			return GameRecord{}, fmt.Errorf("%w: line %d: %v", ErrInvalidNotation, i+1, err)
+		}
+		rec.Tags[key] = value
+	}
+	rules, err := tagRules(rec.Tags)
+	if err != nil {
+		return GameRecord{}, err
+	}
+	if rules != StandardRules {
+		rec.Rules = rules
+	}
+
+	b := rules.NewBoard()
+	player := CellP1
+	finished := false
+	for _, tok := range strings.Fields(strings.Join(lines[i:], " ")) {
+		switch tok {
+		case ResultRedWins, ResultYellowWins, ResultDraw, ResultUnfinished:
+			if rec.Result != "" {
+				return GameRecord{}, fmt.Errorf("%w: more than one result", ErrInvalidNotation)
+			}
+			rec.Result = tok
+			continue
+		}
+		if rec.Result != "" {
+			return GameRecord{}, fmt.Errorf("%w: moves after the result", ErrInvalidNotation)
+		}
+		if strings.HasSuffix(tok, ".") {
+			if _, err := strconv.Atoi(strings.TrimSuffix(tok, ".")); err != nil {
+				return GameRecord{}, fmt.Errorf("%w: bad move number %q", ErrInvalidNotation, tok)
+			}
+			continue
+		}
+		action := ActionDrop
+		if strings.HasPrefix(tok, "p") {
+			action = ActionPop
+		}
+		col, err := strconv.Atoi(strings.TrimPrefix(tok, "p"))
+		if err != nil {
+			return GameRecord{}, fmt.Errorf("%w: bad move %q", ErrInvalidNotation, tok)
+		}
+		if finished {
+			return GameRecord{}, fmt.Errorf("%w: move %d played after the game ended", ErrInvalidNotation, len(rec.Moves)+1)
+		}
+		res, err := rules.Play(b, action, col-1, player)
+		if err != nil {
+			return GameRecord{}, fmt.Errorf("%w: move %d: %v", ErrInvalidNotation, len(rec.Moves)+1, err)
+		}
+		finished = res.Winner != 0 || res.IsDraw
+		rec.Moves = append(rec.Moves, MoveRecord{
+			Number: len(rec.Moves) + 1,
+			Action: action,
+			Column: col - 1,
+			Row:    res.Row,
+			Slot:   player,
+		})
+		player = opponentOf(player)
+	}
+	if rec.Result == "" {
+		rec.Result = rec.Tags["Result"]
+	}
+	if rec.Result == "" {
+		rec.Result = ResultUnfinished
+	}
+	rec.Tags["Result"] = rec.Result
+	return rec, nil
+}
+
+// tagRules reads the Size, Connect and Variant tags, defaulting to
+// StandardRules.
+func tagRules(tags map[string]string) (Rules, error) {
+	rules := StandardRules
+	if size, ok := tags["Size"]; ok {
+		cols, rows, found := strings.Cut(size, "x")
+		var err1, err2 error
+		rules.Columns, err1 = strconv.Atoi(cols)
+		rules.Rows, err2 = strconv.Atoi(rows)
+		if !found || err1 != nil || err2 != nil {
+			return Rules{}, fmt.Errorf("%w: bad Size %q", ErrInvalidNotation, size)
+		}
+	}
+	if connect, ok := tags["Connect"]; ok {
+		n, err := strconv.Atoi(connect)
+		if err != nil {
+			return Rules{}, fmt.Errorf("%w: bad Connect %q", ErrInvalidNotation, connect)
+		}
+		rules.Connect = n
+	}
+	if variant, ok := tags["Variant"]; ok {
+		rules.Variant = variant
+	}
+	if err := rules.Validate(); err != nil {
+		return Rules{}, fmt.Errorf("%w: %v", ErrInvalidNotation, err)
+	}
+	return rules, nil
+}
+
+func parseTag(line string) (string, string, error) {
+	if !strings.HasSuffix(line, "]") {
+		return "", "", errors.New("unterminated tag")
+	}
+	body := strings.TrimSpace(line[1 : len(line)-1])
+	key, rest, ok := strings.Cut(body, " ")
+	if !ok || key == "" {
+		return "", "", errors.New("tag without value")
+	}
+	value, err := strconv.Unquote(strings.TrimSpace(rest))
+	if err != nil {
+		return "", "", fmt.Errorf("bad value for tag %s", key)
+	}
+	return key, value, nil
+}
+
+// Board replays the record's moves and returns the final board.
+func (r GameRecord) Board() (Board, error) {
+	rules := r.rules()
+	b := rules.NewBoard()
+	player := CellP1
+	for i, m := range r.Moves {
+		if _, err := rules.Play(b, m.Action, m.Column, player); err != nil {
+			return nil, fmt.Errorf("move %d: %w", i+1, err)
+		}
+		player = opponentOf(player)
+	}
+	return b, nil
+}
+
+// Position strings describe a single board, FEN style: the rows from top
+// to bottom separated by '/', 'r' and 'y' for Red and Yellow discs and
+// numbers for runs of empty cells, then the side to move. The board size
+// follows from the rows; the winning line length is not recorded.
+//
+//	7/7/7/7/3y3/3r3 r
+
+// FormatPosition writes b with toMove to play as a position string.
+func FormatPosition(b Board, toMove int) string {
+	var sb strings.Builder
+	for r := 0; r < b.Rows(); r++ {
+		if r > 0 {
+			sb.WriteByte('/')
+		}
+		empty := 0
+		for c := 0; c < b.Columns(); c++ {
+			if b[r][c] == CellEmpty {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				sb.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+			sb.WriteByte(discLetter(b[r][c]))
+		}
+		if empty > 0 {
+			sb.WriteString(strconv.Itoa(empty))
+		}
+	}
+	sb.WriteByte(' ')
+	sb.WriteByte(discLetter(toMove))
+	return sb.String()
+}
+
+// ParsePosition reads a position string, rejecting boards with floating
+// discs.
+func ParsePosition(s string) (Board, int, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return nil, 0, fmt.Errorf("%w: expected board and side to move", ErrInvalidPosition)
+	}
+	var cells [][]int
+	for r, row := range strings.Split(fields[0], "/") {
+		var line []int
+		for i := 0; i < len(row); i++ {
+			ch := row[i]
+			switch {
+			case ch >= '1' && ch <= '9':
+				// Runs of ten or more take two digits. Stop reading
+				// digits once the run is too long, before it overflows.
+				n := int(ch - '0')
+				for i+1 < len(row) && row[i+1] >= '0' && row[i+1] <= '9' {
+					i++
+					n = n*10 + int(row[i]-'0')
+					if n > MaxColumns {
+						return nil, 0, fmt.Errorf("%w: row %d is too wide", ErrInvalidPosition, r+1)
+					}
+				}
+				line = append(line, make([]int, n)...)
+			case ch == 'r' || ch == 'y':
+				line = append(line, letterDisc(ch))
+			default:
+				return nil, 0, fmt.Errorf("%w: bad character %q", ErrInvalidPosition, ch)
+			}
+		}
+		if len(cells) > 0 && len(line) != len(cells[0]) {
+			return nil, 0, fmt.Errorf("%w: row %d has %d cells", ErrInvalidPosition, r+1, len(line))
+		}
+		cells = append(cells, line)
+	}
+	size := Rules{Columns: len(cells[0]), Rows: len(cells), Connect: MinConnect, Variant: VariantNormal}
+	if err := size.Validate(); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidPosition, err)
+	}
+	b := size.NewBoard()
+	for r := range cells {
+		copy(b[r], cells[r])
+	}
+	for r := 0; r < b.Rows()-1; r++ {
+		for c := 0; c < b.Columns(); c++ {
+			if b[r][c] != CellEmpty && b[r+1][c] == CellEmpty {
+				return nil, 0, fmt.Errorf("%w: floating disc in column %d", ErrInvalidPosition, c+1)
+			}
+		}
+	}
+	if len(fields[1]) != 1 || (fields[1][0] != 'r' && fields[1][0] != 'y') {
+		return nil, 0, fmt.Errorf("%w: side to move must be r or y", ErrInvalidPosition)
+	}
+	return b, letterDisc(fields[1][0]), nil
+}
+
+func discLetter(player int) byte {
+	if player == CellP2 {
+		return 'y'
+	}
+	return 'r'
+}
+
+func letterDisc(ch byte) int {
+	if ch == 'y' {
+		return CellP2
+	}
+	return CellP1
+}
@@ -0,0 +1,215 @@
+package game
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// moves lists the moves as written, for comparison with what
+		// ParseRecord read.
+		moves  []string
+		rules  Rules
+		result string
+	}{
+		{
+			name: "standard win",
+			text: `[Event "4 in a Row"]
+[Date "2024.01.31"]
+[Red "alice"]
+[Yellow "bob"]
+[Result "1-0"]
+
+1. 4 4 2. 5 3 3. 6 2 4. 7 1-0
+`,
+			moves:  []string{"4", "4", "5", "3", "6", "2", "7"},
+			result: ResultRedWins,
+		},
+		{
+			name: "unfinished",
+			text: `[Red "alice"]
+[Yellow "bob"]
+[Result "*"]
+
+1. 1 7 2. 2 *
+`,
+			moves:  []string{"1", "7", "2"},
+			result: ResultUnfinished,
+		},
+		{
+			name: "no moves",
+			text: `[Result "*"]
+
+*
+`,
+			result: ResultUnfinished,
+		},
+		{
+			name: "popout",
+			text: `[Red "alice"]
+[Yellow "bob"]
+[Result "*"]
+[Size "7x6"]
+[Connect "4"]
+[Variant "popout"]
+
+1. 4 4 2. p4 p4 3. 3 *
+`,
+			moves:  []string{"4", "4", "p4", "p4", "3"},
+			rules:  Rules{Columns: 7, Rows: 6, Connect: 4, Variant: VariantPopOut},
+			result: ResultUnfinished,
+		},
+		{
+			name: "custom size",
+			text: `[Result "1/2-1/2"]
+[Size "9x7"]
+[Connect "5"]
+[Variant "normal"]
+[Round "3"]
+
+1. 5 5 1/2-1/2
+`,
+			moves:  []string{"5", "5"},
+			rules:  Rules{Columns: 9, Rows: 7, Connect: 5, Variant: VariantNormal},
+			result: ResultDraw,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := ParseRecord(tt.text)
+			if err != nil {
+				t.Fatalf("ParseRecord: %v", err)
+			}
+			if rec.Rules != tt.rules {
+				t.Errorf("rules = %+v, want %+v", rec.Rules, tt.rules)
+			}
+			if rec.Result != tt.result {
+				t.Errorf("result = %q, want %q", rec.Result, tt.result)
+			}
+			var moves []string
+			for i, m := range rec.Moves {
+				written := strconv.Itoa(m.Column + 1)
+				if m.Action == ActionPop {
+					written = "p" + written
+				}
+				moves = append(moves, written)
+				if wantSlot := CellP1 + i%2; m.Slot != wantSlot {
+					t.Errorf("move %d slot = %d, want %d", i+1, m.Slot, wantSlot)
+				}
+			}
+			if !reflect.DeepEqual(moves, tt.moves) {
+				t.Errorf("moves = %v, want %v", moves, tt.moves)
+			}
+			if got := rec.String(); got != tt.text {
+				t.Errorf("String() =\n%s\nwant\n%s", got, tt.text)
+			}
+			again, err := ParseRecord(rec.String())
+			if err != nil {
+				t.Fatalf("ParseRecord(String()): %v", err)
+			}
+			if !reflect.DeepEqual(again, rec) {
+				t.Errorf("round trip = %+v, want %+v", again, rec)
+			}
+		})
+	}
+}
+
+func TestParseRecordRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"unterminated tag", "[Red \"alice\"\n\n1. 4 *"},
+		{"tag without value", "[Red]\n\n1. 4 *"},
+		{"unquoted tag value", "[Red alice]\n\n1. 4 *"},
+		{"bad size", "[Size \"7by6\"]\n\n1. 4 *"},
+		{"bad connect", "[Connect \"four\"]\n\n1. 4 *"},
+		{"unknown variant", "[Variant \"gravity\"]\n\n1. 4 *"},
+		{"size out of range", "[Size \"20x6\"]\n\n1. 4 *"},
+		{"bad move number", "x. 4 *"},
+		{"bad move", "1. four *"},
+		{"column out of range", "1. 8 *"},
+		{"column zero", "1. 0 *"},
+		{"pop in normal game", "1. 4 4 2. p4 *"},
+		{"pop of opponent's disc", "[Size \"7x6\"]\n[Connect \"4\"]\n[Variant \"popout\"]\n\n1. 4 p4 *"},
+		{"full column", "1. 1 1 2. 1 1 3. 1 1 4. 1 *"},
+		{"move after win", "1. 1 2 2. 1 2 3. 1 2 4. 1 2 *"},
+		{"move after result", "1. 4 * 4"},
+		{"two results", "1. 4 * 1-0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseRecord(tt.text); !errors.Is(err, ErrInvalidNotation) {
+				t.Fatalf("ParseRecord(%q) error = %v, want %v", tt.text, err, ErrInvalidNotation)
+			}
+		})
+	}
+}
+
+func TestPositionRoundTrip(t *testing.T) {
+	tests := []struct {
+		pos    string
+		toMove int
+		cells  map[[2]int]int // row, column: disc
+	}{
+		{pos: "7/7/7/7/7/7 r", toMove: CellP1},
+		{pos: "7/7/7/7/3y3/3r3 r", toMove: CellP1, cells: map[[2]int]int{{4, 3}: CellP2, {5, 3}: CellP1}},
+		{pos: "7/7/7/7/7/ry4y y", toMove: CellP2, cells: map[[2]int]int{{5, 0}: CellP1, {5, 1}: CellP2, {5, 6}: CellP2}},
+		{pos: "10/10/10/10/10/9r y", toMove: CellP2, cells: map[[2]int]int{{5, 9}: CellP1}},
+		{pos: "4/4/4/r3 y", toMove: CellP2, cells: map[[2]int]int{{3, 0}: CellP1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pos, func(t *testing.T) {
+			b, toMove, err := ParsePosition(tt.pos)
+			if err != nil {
+				t.Fatalf("ParsePosition: %v", err)
+			}
+			if toMove != tt.toMove {
+				t.Errorf("to move = %d, want %d", toMove, tt.toMove)
+			}
+			for r := 0; r < b.Rows(); r++ {
+				for c := 0; c < b.Columns(); c++ {
+					if want := tt.cells[[2]int{r, c}]; b[r][c] != want {
+						t.Errorf("cell %d,%d = %d, want %d", r, c, b[r][c], want)
+					}
+				}
+			}
+			if got := FormatPosition(b, toMove); got != tt.pos {
+				t.Errorf("FormatPosition = %q, want %q", got, tt.pos)
+			}
+		})
+	}
+}
+
+func TestParsePositionRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		pos  string
+	}{
+		{"empty", ""},
+		{"no side to move", "7/7/7/7/7/7"},
+		{"extra field", "7/7/7/7/7/7 r y"},
+		{"bad side to move", "7/7/7/7/7/7 x"},
+		{"long side to move", "7/7/7/7/7/7 ry"},
+		{"bad character", "7/7/7/7/7/3z3 r"},
+		{"uneven rows", "7/7/7/7/7/6 r"},
+		{"floating disc", "7/7/7/7/3r3/7 r"},
+		{"too wide", "11/11/11/11/11/11 r"},
+		{"overflowing run", "9223372036854775808/7/7/7/7/7 r"},
+		{"long run", "99999999999999999999999999/7/7/7/7/7 r"},
+		{"too narrow", "3/3/3/3/3/3 r"},
+		{"too few rows", "7/7 r"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParsePosition(tt.pos); !errors.Is(err, ErrInvalidPosition) {
+				t.Fatalf("ParsePosition(%q) error = %v, want %v", tt.pos, err, ErrInvalidPosition)
+			}
+		})
+	}
+}
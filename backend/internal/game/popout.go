@@ -0,0 +1,85 @@
+package game
+
+import "errors"
+
+// PopOut rules: besides dropping a disc, a player may pop one of their
+// own discs out of the bottom row, and every disc above it falls down one
+// cell. A pop can complete lines for both players at once, in which case
+// the player who popped wins. Since pops can undo progress, a position
+// repeated RepetitionLimit times with the same player to move is a draw.
+
+// RepetitionLimit is how many times a PopOut position may occur before
+// the game is drawn.
+const RepetitionLimit = 3
+
+var ErrCannotPop = errors.New("no disc of yours at the bottom of that column")
+
+// PopMove removes player's disc from the bottom of col and lets the
+// column fall. connect is the number of discs in a row that wins.
+func (b Board) PopMove(col, player, connect int) (MoveResult, error) {
+	if col < 0 || col >= b.Columns() {
+		return MoveResult{}, ErrInvalidCol
+	}
+	bottom := b.Rows() - 1
+	if b[bottom][col] != player {
+		return MoveResult{}, ErrCannotPop
+	}
+	for row := bottom; row > 0; row-- {
+		b[row][col] = b[row-1][col]
+	}
+	b[0][col] = CellEmpty
+
+	res := MoveResult{Board: CopyBoard(b), Action: ActionPop, Row: bottom, Column: col}
+	pos := NewPosition(b, connect)
+	for _, p := range [2]int{player, opponentOf(player)} {
+		if pos.HasWon(p) {
+			res.Winner = p
+			res.Winning = findLine(b, p, connect)
+			break
+		}
+	}
+	return res, nil
+}
+
+// findLine returns the cells of one of player's winning lines.
+func findLine(b Board, player, connect int) [][2]int {
+	directions := [][2]int{{1, 0}, {0, 1}, {1, 1}, {1, -1}}
+	for row := range b {
+		for col := range b[row] {
+			if b[row][col] != player {
+				continue
+			}
+			for _, d := range directions {
+				if coords := winningCoords(b, row, col, player, d[0], d[1]); len(coords) >= connect {
+					return coords
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ChoosePop picks a pop for player, for drop-only bots left without a
+// drop in a PopOut game: a winning pop if there is one, otherwise one that
+// does not hand the opponent a line.
+func ChoosePop(rules Rules, board Board, player int) (int, bool) {
+	safe, losing := -1, -1
+	for col := 0; col < board.Columns(); col++ {
+		res, err := CopyBoard(board).PopMove(col, player, rules.Connect)
+		if err != nil {
+			continue
+		}
+		switch {
+		case res.Winner == player:
+			return col, true
+		case res.Winner == CellEmpty && safe < 0:
+			safe = col
+		case losing < 0:
+			losing = col
+		}
+	}
+	if safe >= 0 {
+		return safe, true
+	}
+	return losing, losing >= 0
+}
@@ -0,0 +1,127 @@
+package game
+
+import "errors"
+
+var (
+	ErrGameNotFound       = errors.New("game not found")
+	ErrNotInGame          = errors.New("not a player in this game")
+	ErrGameNotFinished    = errors.New("game still in progress")
+	ErrRematchUnavailable = errors.New("rematch no longer available")
+)
+
+// Series is the running score of a game and its consecutive rematches.
+type Series struct {
+	Games int            `json:"games"`
+	Wins  map[string]int `json:"wins"`
+	Draws int            `json:"draws"`
+}
+
+// SeriesScore returns the score of the series g belongs to, counting g
+// itself once it has finished.
+func (g *GameState) SeriesScore() Series {
+	s := Series{Games: g.Series.Games, Draws: g.Series.Draws, Wins: make(map[string]int)}
+	for name := range g.Players {
+		s.Wins[name] = g.Series.Wins[name]
+	}
+	if g.Status != StatusFinished {
+		return s
+	}
+	s.Games++
+	if g.Winner == "" {
+		s.Draws++
+	} else {
+		s.Wins[g.Winner]++
+	}
+	return s
+}
+
+// RequestRematch asks for another game against the same opponent once
+// gameID has finished. The first request is recorded as an offer and
+// returns a nil game; the opponent's request, like any request against the
+// bot, accepts it and returns the new game, in which the players swap
+// slots. Asking again after the rematch started returns that game.
+func (m *Manager) RequestRematch(gameID, username string) (*GameState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, ok := m.games[gameID]
+	if !ok {
+		return nil, ErrGameNotFound
+	}
+	if p, ok := g.Players[username]; !ok || p.IsBot {
+		return nil, ErrNotInGame
+	}
+	if g.Status != StatusFinished {
+		return nil, ErrGameNotFinished
+	}
+	if g.next != "" {
+		if next, ok := m.games[g.next]; ok {
+			return next, nil
+		}
+		return nil, ErrRematchUnavailable
+	}
+	for name, p := range g.Players {
+		if p.IsBot {
+			continue
+		}
+		if m.activeGameLocked(name) != nil {
+			return nil, ErrRematchUnavailable
+		}
+	}
+	opponent := g.opponent(username)
+	if !opponent.IsBot && g.rematchOffer != opponent.Username {
+		return nil, m.recordLocked(g, Event{Type: EventRematchOffered, Player: username})
+	}
+	return m.startRematchLocked(g)
+}
+
+// DeclineRematch turns down the opponent's rematch offer in gameID.
+func (m *Manager) DeclineRematch(gameID, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, ok := m.games[gameID]
+	if !ok {
+		return ErrGameNotFound
+	}
+	if _, ok := g.Players[username]; !ok {
+		return ErrNotInGame
+	}
+	if g.rematchOffer == "" || g.rematchOffer == username || g.next != "" {
+		return ErrRematchUnavailable
+	}
+	return m.recordLocked(g, Event{Type: EventRematchDeclined, Player: username})
+}
+
+func (m *Manager) startRematchLocked(g *GameState) (*GameState, error) {
+	c := GameCreated{
+		Room:   g.Room,
+		Rules:  g.Rules,
+		Series: g.SeriesScore(),
+	}
+	for name, p := range g.Players {
+		c.Players = append(c.Players, Player{Username: name, Slot: opponentOf(p.Slot), IsBot: p.IsBot})
+	}
+	if g.Bot != nil {
+		cfg := g.botConfig
+		c.Bot = &cfg
+	}
+	if g.Clock != nil {
+		c.TimeControl = g.Clock.Control
+	}
+	next, err := m.createGameLocked(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.recordLocked(g, Event{Type: EventRematchStarted, Next: next.ID}); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+func (g *GameState) opponent(username string) *Player {
+	for name, p := range g.Players {
+		if name != username {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package game
+
+import (
+	"crypto/rand"
+	"errors"
+	"time"
+)
+
+// RoomTTL is how long a private room waits for its guest.
+const RoomTTL = 30 * time.Minute
+
+// inviteAlphabet leaves out characters that are easily confused when a
+// code is read out loud or typed from a screenshot.
+const inviteAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const inviteLength = 6
+
+var (
+	ErrRoomNotFound   = errors.New("room not found")
+	ErrOwnRoom        = errors.New("cannot join your own room")
+	ErrAlreadyPlaying = errors.New("already in a game")
+)
+
+// Room is a private game waiting for the friend its host invited. Rooms
+// are only joined by their invite code and never fall back to the bot.
+type Room struct {
+	Code        string      `json:"code"`
+	Host        string      `json:"host"`
+	Rules       Rules       `json:"rules"`
+	TimeControl TimeControl `json:"timeControl"`
+	CreatedAt   time.Time   `json:"createdAt"`
+}
+
+// CreateRoom opens a private room hosted by host.
+func (m *Manager) CreateRoom(host string, rules Rules, tc TimeControl) (*Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.activeGameLocked(host) != nil {
+		return nil, ErrAlreadyPlaying
+	}
+	code, err := m.newInviteCodeLocked()
+	if err != nil {
+		return nil, err
+	}
+	// A room replaces any place the host held in the matchmaking queue.
+	m.dequeueLocked(host)
+	room := &Room{Code: code, Host: host, Rules: rules, TimeControl: tc, CreatedAt: time.Now()}
+	m.rooms[code] = room
+	return room, nil
+}
+
+// Room looks up an open room by invite code.
+func (m *Manager) Room(code string) (*Room, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	room, ok := m.rooms[code]
+	return room, ok
+}
+
+// JoinRoom starts the game of the room behind code with username as the
+// guest. The host moves first. The code is used up once the game starts.
+func (m *Manager) JoinRoom(code, username string) (*GameState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	room, ok := m.rooms[code]
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+	if room.Host == username {
+		return nil, ErrOwnRoom
+	}
+	if m.activeGameLocked(username) != nil || m.activeGameLocked(room.Host) != nil {
+		return nil, ErrAlreadyPlaying
+	}
+	delete(m.rooms, code)
+
+	return m.createGameLocked(GameCreated{
+		Room:  code,
+		Rules: room.Rules,
+		Players: []Player{
+			{Username: room.Host, Slot: CellP1},
+			{Username: username, Slot: CellP2},
+		},
+		TimeControl: room.TimeControl,
+	})
+}
+
+func (m *Manager) activeGameLocked(username string) *GameState {
+	if id, ok := m.userToGame[username]; ok {
+		if g, exists := m.games[id]; exists && g.Status != StatusFinished {
+			return g
+		}
+	}
+	return nil
+}
+
+func (m *Manager) newInviteCodeLocked() (string, error) {
+	buf := make([]byte, inviteLength)
+	for {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for i, b := range buf {
+			buf[i] = inviteAlphabet[int(b)%len(inviteAlphabet)]
+		}
+		if _, taken := m.rooms[string(buf)]; !taken {
+			return string(buf), nil
+		}
+	}
+}
+
+// expireRoomsLocked closes rooms whose guest never showed up.
+func (m *Manager) expireRoomsLocked(now time.Time) {
+	for code, room := range m.rooms {
+		if now.Sub(room.CreatedAt) > RoomTTL {
+			delete(m.rooms, code)
+		}
+	}
+}
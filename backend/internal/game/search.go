@@ -0,0 +1,286 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Difficulty selects how deep the bot searches before committing to a move.
+type Difficulty string
+
+const (
+	DifficultyEasy    Difficulty = "easy"
+	DifficultyMedium  Difficulty = "medium"
+	DifficultyHard    Difficulty = "hard"
+	DifficultyPerfect Difficulty = "perfect"
+
+	DefaultDifficulty = DifficultyMedium
+)
+
+var ErrUnknownDifficulty = errors.New("unknown difficulty")
+
+var difficultyDepth = map[Difficulty]int{
+	DifficultyEasy:    1,
+	DifficultyMedium:  4,
+	DifficultyHard:    9,
+	DifficultyPerfect: 14,
+}
+
+// ParseDifficulty maps a user supplied level to a Difficulty. An empty
+// string selects DefaultDifficulty.
+func ParseDifficulty(s string) (Difficulty, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return DefaultDifficulty, nil
+	}
+	d := Difficulty(s)
+	if _, ok := difficultyDepth[d]; !ok {
+		return "", ErrUnknownDifficulty
+	}
+	return d, nil
+}
+
+// Depth returns the search depth in plies, or 0 for an unknown level.
+func (d Difficulty) Depth() int {
+	return difficultyDepth[d]
+}
+
+const (
+	winScore = 1_000_000
+	infScore = winScore + 1
+)
+
+// Search runs a depth limited negamax with alpha-beta pruning for player
+// on a board won by connect discs in a row and returns the best column
+// together with its score. Wins are scored
+// close to winScore, earlier wins higher than later ones. tt may be nil.
+func Search(board Board, connect, player, depth int, tt *TranspositionTable) (int, int) {
+	return SearchContext(context.Background(), board, connect, player, depth, tt)
+}
+
+// SearchContext deepens the search one ply at a time up to depth and
+// returns the result of the deepest iteration that finished before ctx
+// was done. The depth one iteration always completes, so a legal move is
+// returned whenever one exists.
+func SearchContext(ctx context.Context, board Board, connect, player, depth int, tt *TranspositionTable) (int, int) {
+	pos := NewPosition(board, connect)
+	s := &searcher{ctx: ctx, tt: tt}
+	best, bestScore := -1, -infScore
+	for d := 1; d <= max(depth, 1); d++ {
+		col, score := s.root(&pos, player, d)
+		if s.aborted && best >= 0 {
+			break
+		}
+		best, bestScore = col, score
+		if s.aborted || score > winThreshold {
+			break
+		}
+	}
+	return best, bestScore
+}
+
+// searcher carries the state shared by one search: the table and the
+// context whose cancellation aborts it.
+type searcher struct {
+	ctx     context.Context
+	tt      *TranspositionTable
+	nodes   uint64
+	aborted bool
+}
+
+func (s *searcher) root(pos *Position, player, depth int) (int, int) {
+	best, bestScore := -1, -infScore
+	alpha, beta := -infScore, infScore
+	hint := -1
+	if e, ok := s.tt.Probe(pos.Key(player)); ok {
+		hint = int(e.Move)
+	}
+	order, n := orderMoves(pos, hint)
+	for _, col := range order[:n] {
+		if !pos.CanPlay(col) {
+			continue
+		}
+		var score int
+		if pos.IsWinningMove(col, player) {
+			score = winScore - 1
+		} else {
+			pos.Play(col, player)
+			score = -s.negamax(pos, opponentOf(player), depth-1, 1, -beta, -alpha)
+			pos.Undo(col)
+		}
+		if s.aborted && depth > 1 {
+			break
+		}
+		if score > bestScore {
+			best, bestScore = col, score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	return best, bestScore
+}
+
+func (s *searcher) negamax(pos *Position, player, depth, ply, alpha, beta int) int {
+	s.nodes++
+	if s.nodes&1023 == 0 && s.ctx.Err() != nil {
+		s.aborted = true
+	}
+	if pos.Full() {
+		return 0
+	}
+	if depth == 0 {
+		return heuristic(pos, player)
+	}
+	for _, col := range pos.layout.order {
+		if pos.CanPlay(col) && pos.IsWinningMove(col, player) {
+			return winScore - ply - 1
+		}
+	}
+	// An aborted search only unwinds; depth one searches never abort
+	// since they bottom out above.
+	if s.aborted {
+		return 0
+	}
+
+	key := pos.Key(player)
+	alphaOrig := alpha
+	hint := -1
+	if e, ok := s.tt.Probe(key); ok {
+		hint = int(e.Move)
+		if int(e.Depth) >= depth {
+			score := scoreFromTable(int(e.Score), ply)
+			switch e.Bound {
+			case BoundExact:
+				return score
+			case BoundLower:
+				alpha = max(alpha, score)
+			case BoundUpper:
+				beta = min(beta, score)
+			}
+			if alpha >= beta {
+				return score
+			}
+		}
+	}
+
+	bestMove := -1
+	order, n := orderMoves(pos, hint)
+	for _, col := range order[:n] {
+		if !pos.CanPlay(col) {
+			continue
+		}
+		pos.Play(col, player)
+		score := -s.negamax(pos, opponentOf(player), depth-1, ply+1, -beta, -alpha)
+		pos.Undo(col)
+		if s.aborted {
+			return 0
+		}
+		if score > alpha {
+			alpha = score
+			bestMove = col
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+
+	bound := BoundExact
+	switch {
+	case alpha <= alphaOrig:
+		bound = BoundUpper
+	case alpha >= beta:
+		bound = BoundLower
+	}
+	s.tt.Store(TTEntry{
+		Key:   key,
+		Score: int32(scoreToTable(alpha, ply)),
+		Depth: int8(depth),
+		Move:  int8(bestMove),
+		Bound: bound,
+	})
+	return alpha
+}
+
+// orderMoves returns the center-first column order with hint, the best
+// move a previous search stored for this position, moved to the front.
+// Central moves take part in more lines and are searched first so
+// cutoffs come early.
+// The order is returned as an array and its length so that it stays on
+// the stack.
+func orderMoves(pos *Position, hint int) ([MaxColumns]int, int) {
+	var order [MaxColumns]int
+	n := copy(order[:], pos.layout.order)
+	if hint < 0 {
+		return order, n
+	}
+	for i, col := range order[:n] {
+		if col == hint {
+			copy(order[1:i+1], order[:i])
+			order[0] = col
+			break
+		}
+	}
+	return order, n
+}
+
+// Win scores encode the distance from the root; the table stores them
+// relative to the node instead so they stay valid at any ply.
+const winThreshold = winScore - maxCells - 1
+
+func scoreToTable(score, ply int) int {
+	switch {
+	case score > winThreshold:
+		return score + ply
+	case score < -winThreshold:
+		return score - ply
+	}
+	return score
+}
+
+func scoreFromTable(score, ply int) int {
+	switch {
+	case score > winThreshold:
+		return score - ply
+	case score < -winThreshold:
+		return score + ply
+	}
+	return score
+}
+
+// heuristic scores every winning window from player's perspective,
+// rewarding windows one and two discs short of a line and weighting the
+// center column.
+func heuristic(pos *Position, player int) int {
+	l := pos.layout
+	own, theirs := pos.Discs(player), pos.Discs(opponentOf(player))
+	score := 3 * (popcount(own&l.center) - popcount(theirs&l.center))
+	for _, m := range l.lines {
+		score += scoreWindow(popcount(own&m), popcount(theirs&m), l.rules.Connect)
+	}
+	return score
+}
+
+func scoreWindow(own, theirs, connect int) int {
+	switch {
+	case own > 0 && theirs > 0:
+		return 0
+	case own == connect-1:
+		return 5
+	case own == connect-2:
+		return 2
+	case theirs == connect-1:
+		return -4
+	case theirs == connect-2:
+		return -1
+	}
+	return 0
+}
+
+func opponentOf(player int) int {
+	if player == CellP1 {
+		return CellP2
+	}
+	return CellP1
+}
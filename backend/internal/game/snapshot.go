@@ -0,0 +1,148 @@
+package game
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// Snapshot is the serializable state of a game in progress, enough to
+// resume it after a restart.
+type Snapshot struct {
+	ID string `json:"id"`
+	// Version is the Seq of the last event the snapshot includes.
+	Version    int            `json:"version"`
+	Room       string         `json:"room,omitempty"`
+	Rules      Rules          `json:"rules"`
+	Board      Board          `json:"board"`
+	Status     string         `json:"status"`
+	Winner     string         `json:"winner,omitempty"`
+	Reason     EndReason      `json:"reason,omitempty"`
+	StartedAt  time.Time      `json:"startedAt"`
+	EndedAt    time.Time      `json:"endedAt"`
+	Turn       int            `json:"turn"`
+	LastMoveAt time.Time      `json:"lastMoveAt"`
+	Players    []Player       `json:"players"`
+	Bot        *BotConfig     `json:"bot,omitempty"`
+	Moves      []MoveRecord   `json:"moves"`
+	Clock      *ClockSnapshot `json:"clock,omitempty"`
+	Series     Series         `json:"series"`
+	// Seen holds the PopOut repetition counts.
+	Seen map[uint64]int `json:"seen,omitempty"`
+}
+
+// ClockSnapshot is a clock frozen at the moment of the snapshot.
+type ClockSnapshot struct {
+	Control   TimeControl      `json:"control"`
+	Remaining [2]time.Duration `json:"remaining"`
+	Running   int              `json:"running"`
+}
+
+// Snapshot captures g as of its last event. It must be called with the
+// manager's lock held or before g is shared.
+func (g *GameState) Snapshot() Snapshot {
+	s := Snapshot{
+		ID:         g.ID,
+		Version:    g.version,
+		Room:       g.Room,
+		Rules:      g.Rules,
+		Board:      CopyBoard(g.Board),
+		Status:     g.Status,
+		Winner:     g.Winner,
+		Reason:     g.Reason,
+		StartedAt:  g.StartedAt,
+		EndedAt:    g.EndedAt,
+		Turn:       g.Turn,
+		LastMoveAt: g.LastMoveAt,
+		Moves:      append([]MoveRecord(nil), g.Moves...),
+		Series:     g.Series,
+	}
+	for _, p := range g.Players {
+		s.Players = append(s.Players, *p)
+	}
+	sort.Slice(s.Players, func(i, j int) bool { return s.Players[i].Slot < s.Players[j].Slot })
+	if g.Bot != nil {
+		cfg := g.botConfig
+		s.Bot = &cfg
+	}
+	if g.Clock != nil {
+		// Freeze the clock when the last event happened, so snapshots
+		// taken from the live game and from its rebuilt log agree.
+		at := g.changedAt
+		s.Clock = &ClockSnapshot{
+			Control:   g.Clock.Control,
+			Remaining: [2]time.Duration{g.Clock.Remaining(CellP1, at), g.Clock.Remaining(CellP2, at)},
+			Running:   g.Clock.running,
+		}
+	}
+	if len(g.seen) > 0 {
+		s.Seen = make(map[uint64]int, len(g.seen))
+		for k, v := range g.seen {
+			s.Seen[k] = v
+		}
+	}
+	return s
+}
+
+// SetSnapshotter makes the manager pass a Snapshot of a game to fn after
+// every event of the game. fn is called with the manager's
+// lock held, so it must hand the snapshot off rather than store it
+// itself.
+func (m *Manager) SetSnapshotter(fn func(Snapshot)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshotter = fn
+}
+
+func (m *Manager) changedLocked(g *GameState) {
+	if m.snapshotter != nil {
+		m.snapshotter(g.Snapshot())
+	}
+}
+
+// Restore resumes the active games in snaps, typically the snapshots
+// saved before a restart, and returns them. Each game continues its log
+// with a game_restored event, so the time a game spent offline counts
+// neither on its clocks nor against the reconnect window. logged holds
+// the Seq of the last event in the log of each game, which the snapshot
+// may be behind or ahead of; games missing from it continue from their
+// snapshot's version.
+func (m *Manager) Restore(snaps []Snapshot, logged map[string]int) []*GameState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var restored []*GameState
+	for _, s := range snaps {
+		if s.Status != StatusActive {
+			continue
+		}
+		if _, exists := m.games[s.ID]; exists {
+			continue
+		}
+		var bot Strategy
+		if s.Bot != nil {
+			var err error
+			for _, p := range s.Players {
+				if p.IsBot {
+					bot, err = m.newBotLocked(s.Rules, p.Slot, *s.Bot)
+				}
+			}
+			if err != nil {
+				log.Printf("cannot restore the bot of game %s: %v", s.ID, err)
+				continue
+			}
+		}
+		s := s
+		seq := s.Version + 1
+		if last, ok := logged[s.ID]; ok {
+			seq = last + 1
+		}
+		g := &GameState{ID: s.ID}
+		if err := m.recordLocked(g, Event{Type: EventGameRestored, Seq: seq, Restored: &s}); err != nil {
+			log.Printf("cannot restore game %s: %v", s.ID, err)
+			continue
+		}
+		m.attachLocked(g, bot)
+		restored = append(restored, g)
+	}
+	return restored
+}
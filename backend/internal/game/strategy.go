@@ -0,0 +1,153 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Strategy is a bot engine. ChooseMove must return a legal column for the
+// strategy's player whenever the board has one, and should return early
+// once ctx is done, playing the best move it has found so far.
+type Strategy interface {
+	Name() string
+	// Metadata describes the configured strategy, e.g. its difficulty.
+	Metadata() map[string]string
+	ChooseMove(ctx context.Context, board Board) (int, error)
+}
+
+// StrategyOptions carries everything a factory may use to build a
+// strategy. Factories ignore the fields they have no use for.
+type StrategyOptions struct {
+	Player     int
+	Difficulty Difficulty
+	// Rules defaults to StandardRules when left zero.
+	Rules  Rules
+	Seed   int64
+	Table  *TranspositionTable
+	Book   *OpeningBook
+	Solver Solver
+}
+
+// Solver finds provably best moves under StandardRules. The solver
+// package implements it; it lives outside this package, which it
+// imports.
+type Solver interface {
+	// BestMove returns a move of player that is best under perfect play,
+	// or false if the position could not be solved before ctx was done.
+	BestMove(ctx context.Context, board Board, player int) (int, bool)
+}
+
+// StrategyFactory builds a strategy playing opts.Player.
+type StrategyFactory func(opts StrategyOptions) Strategy
+
+// StrategyInfo describes a registered strategy.
+type StrategyInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+const (
+	StrategyClassic = "classic"
+	StrategyMinimax = "minimax"
+	StrategyMCTS    = "mcts"
+
+	DefaultStrategy = StrategyMinimax
+)
+
+var (
+	ErrUnknownStrategy = errors.New("unknown bot strategy")
+	ErrNoMove          = errors.New("no legal move")
+)
+
+type registeredStrategy struct {
+	info    StrategyInfo
+	factory StrategyFactory
+}
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = make(map[string]registeredStrategy)
+)
+
+func init() {
+	RegisterStrategy(StrategyClassic, "Takes wins, blocks threats, otherwise plays near the center",
+		func(opts StrategyOptions) Strategy {
+			b := NewClassicBot(opts.Player)
+			b.Rules = opts.Rules
+			return b
+		})
+	RegisterStrategy(StrategyMinimax, "Negamax search with alpha-beta pruning and an opening book; the perfect level solves positions exactly",
+		func(opts StrategyOptions) Strategy {
+			b := NewBot(opts.Player, opts.Difficulty)
+			b.Rules = opts.Rules
+			b.Table = opts.Table
+			b.Book = opts.Book
+			b.Solver = opts.Solver
+			return b
+		})
+	RegisterStrategy(StrategyMCTS, "Adventurous Monte Carlo Tree Search player",
+		func(opts StrategyOptions) Strategy {
+			b := NewMCTSBot(opts.Player, opts.Difficulty, opts.Seed)
+			b.Rules = opts.Rules
+			return b
+		})
+}
+
+// RegisterStrategy makes a strategy available by name. It panics if the
+// name is already taken, so it is meant to be called from init.
+func RegisterStrategy(name, description string, factory StrategyFactory) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	if _, dup := strategies[name]; dup {
+		panic(fmt.Sprintf("game: strategy %q registered twice", name))
+	}
+	strategies[name] = registeredStrategy{
+		info:    StrategyInfo{Name: name, Description: description},
+		factory: factory,
+	}
+}
+
+// ParseStrategy validates a user supplied strategy name. An empty string
+// selects DefaultStrategy.
+func ParseStrategy(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return DefaultStrategy, nil
+	}
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	if _, ok := strategies[s]; !ok {
+		return "", ErrUnknownStrategy
+	}
+	return s, nil
+}
+
+// NewStrategy builds the strategy registered under name.
+func NewStrategy(name string, opts StrategyOptions) (Strategy, error) {
+	strategiesMu.RLock()
+	entry, ok := strategies[name]
+	strategiesMu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownStrategy
+	}
+	if opts.Rules == (Rules{}) {
+		opts.Rules = StandardRules
+	}
+	return entry.factory(opts), nil
+}
+
+// Strategies lists the registered strategies sorted by name.
+func Strategies() []StrategyInfo {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	res := make([]StrategyInfo, 0, len(strategies))
+	for _, entry := range strategies {
+		res = append(res, entry.info)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
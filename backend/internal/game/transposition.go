@@ -0,0 +1,168 @@
+package game
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// zobristKeys holds one random key per player and bit. They come from a
+// fixed splitmix64 stream so hashes are stable across restarts, which
+// lets opening books and logs refer to positions by hash.
+var zobristKeys, zobristSide = func() ([2][maxCells]uint64, uint64) {
+	var keys [2][maxCells]uint64
+	seed := uint64(0x4a5f1c3e9b7d2a61)
+	next := func() uint64 {
+		seed += 0x9e3779b97f4a7c15
+		return mix64(seed)
+	}
+	for p := range keys {
+		for i := range keys[p] {
+			keys[p][i] = next()
+		}
+	}
+	return keys, next()
+}()
+
+// mix64 is the splitmix64 finalizer.
+func mix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (l *layout) zobrist(player, col, height int) uint64 {
+	return zobristKeys[player-1][col*l.colBits+height]
+}
+
+// Hash returns the Zobrist hash of the discs on the board.
+func (p *Position) Hash() uint64 {
+	return p.hash
+}
+
+// Key combines the position hash with the side to move, which the board
+// alone does not determine when the bot may play either slot.
+func (p *Position) Key(player int) uint64 {
+	if player == CellP2 {
+		return p.hash ^ zobristSide
+	}
+	return p.hash
+}
+
+// Bound records how a stored score relates to the true value of a node.
+type Bound uint8
+
+const (
+	BoundNone  Bound = iota
+	BoundExact       // score is the exact value
+	BoundLower       // search failed high: value >= score
+	BoundUpper       // search failed low: value <= score
+)
+
+// TTEntry is a single transposition table record.
+type TTEntry struct {
+	Key   uint64
+	Score int32
+	Depth int8
+	Move  int8
+	Bound Bound
+}
+
+// TTStats is a snapshot of table usage counters.
+type TTStats struct {
+	Entries      int     `json:"entries"`
+	Probes       uint64  `json:"probes"`
+	Hits         uint64  `json:"hits"`
+	Stores       uint64  `json:"stores"`
+	Replacements uint64  `json:"replacements"`
+	HitRate      float64 `json:"hitRate"`
+}
+
+const ttShards = 64
+
+// TranspositionTable is a fixed size, concurrency safe cache of search
+// results keyed by position hash. Slots are guarded by sharded locks so
+// concurrent bot games rarely contend. When two positions collide on a
+// slot the deeper search result is kept; an entry for the same position
+// is always refreshed. A nil table is valid and caches nothing.
+type TranspositionTable struct {
+	entries []TTEntry
+	mask    uint64
+	locks   [ttShards]sync.Mutex
+
+	probes       atomic.Uint64
+	hits         atomic.Uint64
+	stores       atomic.Uint64
+	replacements atomic.Uint64
+}
+
+// NewTranspositionTable allocates a table with room for size entries,
+// rounded down to a power of two. A size below one returns nil.
+func NewTranspositionTable(size int) *TranspositionTable {
+	if size < 1 {
+		return nil
+	}
+	n := 1
+	for n*2 <= size {
+		n *= 2
+	}
+	return &TranspositionTable{
+		entries: make([]TTEntry, n),
+		mask:    uint64(n - 1),
+	}
+}
+
+// Probe looks up key and reports whether a matching entry was found.
+func (t *TranspositionTable) Probe(key uint64) (TTEntry, bool) {
+	if t == nil {
+		return TTEntry{}, false
+	}
+	t.probes.Add(1)
+	idx := key & t.mask
+	lock := &t.locks[idx%ttShards]
+	lock.Lock()
+	e := t.entries[idx]
+	lock.Unlock()
+	if e.Bound == BoundNone || e.Key != key {
+		return TTEntry{}, false
+	}
+	t.hits.Add(1)
+	return e, true
+}
+
+// Store records e, subject to the depth preferred replacement policy.
+func (t *TranspositionTable) Store(e TTEntry) {
+	if t == nil {
+		return
+	}
+	idx := e.Key & t.mask
+	lock := &t.locks[idx%ttShards]
+	lock.Lock()
+	defer lock.Unlock()
+	cur := &t.entries[idx]
+	if cur.Bound != BoundNone && cur.Key != e.Key {
+		if e.Depth < cur.Depth {
+			return
+		}
+		t.replacements.Add(1)
+	}
+	*cur = e
+	t.stores.Add(1)
+}
+
+// Stats returns the usage counters collected since the table was created.
+func (t *TranspositionTable) Stats() TTStats {
+	if t == nil {
+		return TTStats{}
+	}
+	s := TTStats{
+		Entries:      len(t.entries),
+		Probes:       t.probes.Load(),
+		Hits:         t.hits.Load(),
+		Stores:       t.stores.Load(),
+		Replacements: t.replacements.Load(),
+	}
+	if s.Probes > 0 {
+		s.HitRate = float64(s.Hits) / float64(s.Probes)
+	}
+	return s
+}
@@ -0,0 +1,99 @@
+package game
+
+import (
+	"sort"
+	"time"
+)
+
+// View is a copy of a game taken under the manager's lock. The game itself
+// keeps changing under clock timers and other players' moves, so messages
+// about it are built from a View rather than from the *GameState.
+type View struct {
+	ID        string
+	Room      string
+	Rules     Rules
+	Board     Board
+	Turn      int
+	Status    string
+	Winner    string
+	Reason    EndReason
+	StartedAt time.Time
+	Moves     []MoveRecord
+	Players   map[string]Player
+	// Clock is the clock as the view was taken, nil in untimed games.
+	Clock *ClockState
+	// Series is the series score, counting the game once it has finished.
+	Series Series
+	// Bot plays the bot's seat, nil in games between people.
+	Bot Strategy
+}
+
+// View returns a copy of gameID as it is now.
+func (m *Manager) View(gameID string) (View, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	g, ok := m.games[gameID]
+	if !ok {
+		return View{}, false
+	}
+	return g.view(time.Now()), true
+}
+
+// ActiveGames returns copies of the games still being played, most recent
+// first.
+func (m *Manager) ActiveGames() []View {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := time.Now()
+	var res []View
+	for _, g := range m.games {
+		if g.Status == StatusActive {
+			res = append(res, g.view(now))
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].StartedAt.After(res[j].StartedAt) })
+	return res
+}
+
+// view copies g as of now. It must be called with the manager's lock held.
+func (g *GameState) view(now time.Time) View {
+	v := View{
+		ID:        g.ID,
+		Room:      g.Room,
+		Rules:     g.Rules,
+		Board:     CopyBoard(g.Board),
+		Turn:      g.Turn,
+		Status:    g.Status,
+		Winner:    g.Winner,
+		Reason:    g.Reason,
+		StartedAt: g.StartedAt,
+		Moves:     append([]MoveRecord(nil), g.Moves...),
+		Players:   make(map[string]Player, len(g.Players)),
+		Series:    g.SeriesScore(),
+		Bot:       g.Bot,
+	}
+	for name, p := range g.Players {
+		v.Players[name] = *p
+	}
+	if g.Clock != nil {
+		state := g.Clock.State(now)
+		v.Clock = &state
+	}
+	return v
+}
+
+// Seated returns the username playing slot, or "" if nobody does.
+func (v View) Seated(slot int) string {
+	for name, p := range v.Players {
+		if p.Slot == slot {
+			return name
+		}
+	}
+	return ""
+}
+
+// BotToMove reports whether the game is waiting on its bot.
+func (v View) BotToMove() bool {
+	p, ok := v.Players["bot"]
+	return v.Bot != nil && v.Status == StatusActive && ok && v.Turn == p.Slot
+}
@@ -0,0 +1,68 @@
+package protocol
+
+import (
+	"errors"
+
+	"emittr/backend/internal/game"
+)
+
+// ErrorCode tells a client why the server refused a message, so it need
+// not parse the human readable text.
+type ErrorCode string
+
+const (
+	// CodeMalformed: the message is not valid for its type.
+	CodeMalformed ErrorCode = "malformed_message"
+	// CodeUnknownType: no client message has that type.
+	CodeUnknownType ErrorCode = "unknown_message_type"
+	// CodeUnsupportedVersion: the handshake offered no version the server
+	// speaks.
+	CodeUnsupportedVersion ErrorCode = "unsupported_version"
+	// CodeNotYourTurn: a move out of turn.
+	CodeNotYourTurn ErrorCode = "not_your_turn"
+	// CodeIllegalMove: a move the rules do not allow.
+	CodeIllegalMove ErrorCode = "illegal_move"
+	// CodeGameOver: the game has already finished.
+	CodeGameOver ErrorCode = "game_over"
+	// CodeNoGame: the sender has no game the message could apply to.
+	CodeNoGame ErrorCode = "no_game"
+	// CodeReadOnly: spectators cannot play.
+	CodeReadOnly ErrorCode = "read_only"
+	// CodeAlreadyConnected: the username is connected elsewhere.
+	CodeAlreadyConnected ErrorCode = "already_connected"
+	// CodeRejected: the message is valid but not possible right now, e.g.
+	// answering a draw offer nobody made.
+	CodeRejected ErrorCode = "rejected"
+)
+
+// ErrorCodes lists every error code.
+var ErrorCodes = []ErrorCode{
+	CodeMalformed, CodeUnknownType, CodeUnsupportedVersion, CodeNotYourTurn, CodeIllegalMove,
+	CodeGameOver, CodeNoGame, CodeReadOnly, CodeAlreadyConnected, CodeRejected,
+}
+
+// ErrorFor returns the error message reporting err.
+func ErrorFor(err error) Error {
+	return Error{Code: codeOf(err), Message: err.Error()}
+}
+
+func codeOf(err error) ErrorCode {
+	switch {
+	case errors.Is(err, ErrMalformed):
+		return CodeMalformed
+	case errors.Is(err, ErrUnknownType):
+		return CodeUnknownType
+	case errors.Is(err, ErrUnsupportedVersion):
+		return CodeUnsupportedVersion
+	case errors.Is(err, game.ErrInvalidTurn):
+		return CodeNotYourTurn
+	case errors.Is(err, game.ErrColumnFull), errors.Is(err, game.ErrInvalidCol),
+		errors.Is(err, game.ErrInvalidMove), errors.Is(err, game.ErrCannotPop):
+		return CodeIllegalMove
+	case errors.Is(err, game.ErrGameFinished):
+		return CodeGameOver
+	case errors.Is(err, game.ErrGameNotFound), errors.Is(err, game.ErrNotInGame):
+		return CodeNoGame
+	}
+	return CodeRejected
+}
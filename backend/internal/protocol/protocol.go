@@ -0,0 +1,347 @@
+// Package protocol defines the messages exchanged over the game
+// websocket. Every message is a JSON object whose "type" field names it;
+// the other fields are those of the Go type registered for that name.
+// Clients pick the protocol version in the handshake and the server
+// answers with a welcome message naming the version in use.
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"emittr/backend/internal/game"
+)
+
+// Version is the newest protocol version the server speaks, and
+// MinVersion the oldest. Version 1 is the protocol as it was before
+// versions were negotiated, so clients that do not ask get it.
+const (
+	Version    = 1
+	MinVersion = 1
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported protocol version")
+	ErrMalformed          = errors.New("malformed message")
+	ErrUnknownType        = errors.New("unknown message type")
+)
+
+// Versions lists the versions the server speaks, oldest first.
+func Versions() []int {
+	res := make([]int, 0, Version-MinVersion+1)
+	for v := MinVersion; v <= Version; v++ {
+		res = append(res, v)
+	}
+	return res
+}
+
+// Negotiate picks the version to speak with a client that offered the
+// comma separated versions in offer: the newest both sides know.
+func Negotiate(offer string) (int, error) {
+	if offer == "" {
+		return MinVersion, nil
+	}
+	best := 0
+	for _, v := range strings.Split(offer, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrUnsupportedVersion, v)
+		}
+		if n >= MinVersion && n <= Version && n > best {
+			best = n
+		}
+	}
+	if best == 0 {
+		return 0, fmt.Errorf("%w: server speaks %d to %d", ErrUnsupportedVersion, MinVersion, Version)
+	}
+	return best, nil
+}
+
+// A Message is anything sent over the websocket.
+type Message interface {
+	// MessageType is the value of the message's type field.
+	MessageType() string
+}
+
+// Client to server messages.
+
+// Move plays a disc: drops it in Column, 0-based, or in PopOut pops it
+// from the bottom of Column. Action defaults to a drop.
+type Move struct {
+	Column int         `json:"column"`
+	Action game.Action `json:"action,omitempty"`
+}
+
+// Resign ends the game as a loss for the sender.
+type Resign struct{}
+
+// OfferDraw offers the opponent a draw, or accepts theirs.
+type OfferDraw struct{}
+
+// AcceptDraw accepts the opponent's draw offer.
+type AcceptDraw struct{}
+
+// DeclineDraw declines the opponent's draw offer.
+type DeclineDraw struct{}
+
+// Rematch offers a rematch of the last game, or accepts the opponent's.
+type Rematch struct{}
+
+// DeclineRematch declines the opponent's rematch offer.
+type DeclineRematch struct{}
+
+func (Move) MessageType() string           { return "move" }
+func (Resign) MessageType() string         { return "resign" }
+func (OfferDraw) MessageType() string      { return "offer_draw" }
+func (AcceptDraw) MessageType() string     { return "accept_draw" }
+func (DeclineDraw) MessageType() string    { return "decline_draw" }
+func (Rematch) MessageType() string        { return "rematch" }
+func (DeclineRematch) MessageType() string { return "decline_rematch" }
+
+func (m Move) validate() error {
+	if m.Action != "" && m.Action != game.ActionDrop && m.Action != game.ActionPop {
+		return fmt.Errorf("action must be %q or %q", game.ActionDrop, game.ActionPop)
+	}
+	return nil
+}
+
+// Server to client messages.
+
+// Welcome is the first message on every connection.
+type Welcome struct {
+	Protocol int `json:"protocol"`
+}
+
+// Session carries a fresh session token for the player; it follows the
+// welcome on player connections.
+type Session struct {
+	Token string `json:"token"`
+}
+
+// Waiting tells the player they wait for an opponent. Room, Rules and
+// TimeControl describe the private room they wait in, if any.
+type Waiting struct {
+	Message     string            `json:"message"`
+	Room        string            `json:"room,omitempty"`
+	Rules       *game.Rules       `json:"rules,omitempty"`
+	TimeControl *game.TimeControl `json:"timeControl,omitempty"`
+}
+
+// Init describes a game when a player or spectator joins it. Players get
+// You, Slot, Opponent, Spectators and Series; spectators get Spectator,
+// Players and Moves.
+type Init struct {
+	GameID     string            `json:"gameId"`
+	Spectator  bool              `json:"spectator,omitempty"`
+	Rules      game.Rules        `json:"rules"`
+	Board      game.Board        `json:"board"`
+	Turn       int               `json:"turn"`
+	You        string            `json:"you,omitempty"`
+	Slot       int               `json:"slot,omitempty"`
+	Opponent   string            `json:"opponent,omitempty"`
+	Players    []string          `json:"players,omitempty"`
+	Status     string            `json:"status"`
+	Winner     string            `json:"winner"`
+	Reason     game.EndReason    `json:"reason"`
+	Moves      []game.MoveRecord `json:"moves,omitempty"`
+	Clock      *game.ClockState  `json:"clock"`
+	Spectators int               `json:"spectators,omitempty"`
+	Series     *game.Series      `json:"series,omitempty"`
+	Bot        *Bot              `json:"bot,omitempty"`
+	Timestamp  time.Time         `json:"timestamp"`
+}
+
+// Bot describes the bot opponent of a game.
+type Bot struct {
+	Strategy string            `json:"strategy"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// State is the game after a move or any other change, sent to its
+// players and spectators.
+type State struct {
+	Board  game.Board        `json:"board"`
+	Turn   int               `json:"turn"`
+	Status string            `json:"status"`
+	Winner string            `json:"winner"`
+	Reason game.EndReason    `json:"reason"`
+	Moves  []game.MoveRecord `json:"moves"`
+	Clock  *game.ClockState  `json:"clock"`
+	Series game.Series       `json:"series"`
+}
+
+// DrawOffer tells a player their opponent offers a draw.
+type DrawOffer struct {
+	GameID string `json:"gameId"`
+	From   string `json:"from"`
+}
+
+// DrawDeclined tells a player their draw offer was declined.
+type DrawDeclined struct {
+	GameID string `json:"gameId"`
+	By     string `json:"by"`
+}
+
+// RematchOffer tells a player their opponent wants a rematch.
+type RematchOffer struct {
+	GameID string `json:"gameId"`
+	From   string `json:"from"`
+}
+
+// RematchDeclined tells a player their rematch offer was declined.
+type RematchDeclined struct {
+	GameID string `json:"gameId"`
+	By     string `json:"by"`
+}
+
+// Rating is a player's new rating after a rated game.
+type Rating struct {
+	GameID string  `json:"gameId"`
+	Rating float64 `json:"rating"`
+	RD     float64 `json:"rd"`
+	Change float64 `json:"change"`
+	Games  int     `json:"games"`
+}
+
+// Spectators is the number of people watching a game.
+type Spectators struct {
+	GameID     string `json:"gameId"`
+	Spectators int    `json:"spectators"`
+}
+
+// Error reports a message the server could not act on.
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+func (Welcome) MessageType() string         { return "welcome" }
+func (Session) MessageType() string         { return "session" }
+func (Waiting) MessageType() string         { return "waiting" }
+func (Init) MessageType() string            { return "init" }
+func (State) MessageType() string           { return "state" }
+func (DrawOffer) MessageType() string       { return "draw_offer" }
+func (DrawDeclined) MessageType() string    { return "draw_declined" }
+func (RematchOffer) MessageType() string    { return "rematch_offer" }
+func (RematchDeclined) MessageType() string { return "rematch_declined" }
+func (Rating) MessageType() string          { return "rating" }
+func (Spectators) MessageType() string      { return "spectators" }
+func (Error) MessageType() string           { return "error" }
+
+// ClientMessages and ServerMessages list one of each message in each
+// direction.
+var (
+	ClientMessages = []Message{Move{}, Resign{}, OfferDraw{}, AcceptDraw{}, DeclineDraw{}, Rematch{}, DeclineRematch{}}
+	ServerMessages = []Message{
+		Welcome{}, Session{}, Waiting{}, Init{}, State{}, DrawOffer{}, DrawDeclined{},
+		RematchOffer{}, RematchDeclined{}, Rating{}, Spectators{}, Error{},
+	}
+)
+
+var clientTypes = make(map[string]reflect.Type)
+
+func init() {
+	for _, m := range ClientMessages {
+		clientTypes[m.MessageType()] = reflect.TypeOf(m)
+	}
+}
+
+// Encode writes m as JSON with its type field first.
+func Encode(m Message) []byte {
+	body, err := json.Marshal(m)
+	if err != nil {
+		// The message types only hold values that marshal.
+		panic(err)
+	}
+	typ, _ := json.Marshal(m.MessageType())
+	var buf bytes.Buffer
+	buf.WriteString(`{"type":`)
+	buf.Write(typ)
+	if len(body) > 2 {
+		buf.WriteByte(',')
+	}
+	buf.Write(body[1:])
+	return buf.Bytes()
+}
+
+// Decode reads a client message. It returns an error wrapping
+// ErrUnknownType for types that are not client messages, and one wrapping
+// ErrMalformed for anything that is not a message of its type: bad JSON,
+// fields of the wrong type, unknown fields and missing required fields.
+func Decode(data []byte) (Message, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("%w: not a JSON object", ErrMalformed)
+	}
+	var typ string
+	if err := json.Unmarshal(fields["type"], &typ); err != nil || typ == "" {
+		return nil, fmt.Errorf("%w: type must be a string", ErrMalformed)
+	}
+	t, ok := clientTypes[typ]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownType, typ)
+	}
+	delete(fields, "type")
+	for _, name := range requiredFields(t) {
+		if _, ok := fields[name]; !ok {
+			return nil, fmt.Errorf("%w: %s needs %s", ErrMalformed, typ, name)
+		}
+	}
+	rest, _ := json.Marshal(fields)
+	dec := json.NewDecoder(bytes.NewReader(rest))
+	dec.DisallowUnknownFields()
+	v := reflect.New(t)
+	if err := dec.Decode(v.Interface()); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrMalformed, typ, err)
+	}
+	m := v.Elem().Interface().(Message)
+	if m, ok := m.(interface{ validate() error }); ok {
+		if err := m.validate(); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrMalformed, typ, err)
+		}
+	}
+	return m, nil
+}
+
+// requiredFields returns the JSON names of the fields of struct type t
+// that are not omitempty.
+func requiredFields(t reflect.Type) []string {
+	var res []string
+	for i := 0; i < t.NumField(); i++ {
+		name, omitempty, ok := jsonField(t.Field(i))
+		if ok && !omitempty {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// jsonField returns the JSON name of f and whether it is omitempty; ok
+// is false for fields left out of the JSON.
+func jsonField(f reflect.StructField) (name string, omitempty, ok bool) {
+	if !f.IsExported() {
+		return "", false, false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty, true
+}
@@ -0,0 +1,157 @@
+package protocol
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"emittr/backend/internal/game"
+)
+
+// SchemaID identifies the schema of the current version.
+const SchemaID = "https://emittr.dev/schemas/websocket-protocol/v1.json"
+
+// enums lists the values of string types limited to a few.
+var enums = map[reflect.Type][]string{
+	reflect.TypeOf(game.Action("")): {string(game.ActionDrop), string(game.ActionPop)},
+	reflect.TypeOf(game.EndReason("")): {
+		"", string(game.ReasonConnect), string(game.ReasonFullBoard), string(game.ReasonRepetition),
+		string(game.ReasonTimeout), string(game.ReasonResignation), string(game.ReasonDrawAgreed), string(game.ReasonForfeit),
+	},
+	reflect.TypeOf(ErrorCode("")): errorCodeNames(),
+}
+
+func errorCodeNames() []string {
+	res := make([]string, len(ErrorCodes))
+	for i, c := range ErrorCodes {
+		res[i] = string(c)
+	}
+	return res
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Schema returns the JSON Schema (draft 2020-12) of every message,
+// generated from the message types. ClientMessage and ServerMessage in
+// $defs cover each direction.
+func Schema() []byte {
+	g := schemaGen{defs: make(map[string]any)}
+	clients := g.messages(ClientMessages)
+	servers := g.messages(ServerMessages)
+	g.defs["ClientMessage"] = map[string]any{"oneOf": clients}
+	g.defs["ServerMessage"] = map[string]any{"oneOf": servers}
+	data, err := json.MarshalIndent(map[string]any{
+		"$schema":  "https://json-schema.org/draft/2020-12/schema",
+		"$id":      SchemaID,
+		"$comment": "Every message is an object whose type field names it.",
+		"title":    "4 in a Row websocket protocol",
+		"version":  Version,
+		"$defs":    g.defs,
+		"anyOf":    []any{ref("ClientMessage"), ref("ServerMessage")},
+	}, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+type schemaGen struct {
+	defs map[string]any
+}
+
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/$defs/" + name}
+}
+
+// messages adds the schema of each message to defs, with its type field,
+// and returns references to them.
+func (g *schemaGen) messages(msgs []Message) []any {
+	res := make([]any, len(msgs))
+	for i, m := range msgs {
+		t := reflect.TypeOf(m)
+		s := g.object(t)
+		s["properties"].(map[string]any)["type"] = map[string]any{"const": m.MessageType()}
+		s["required"] = append([]string{"type"}, s["required"].([]string)...)
+		g.defs[t.Name()] = s
+		res[i] = ref(t.Name())
+	}
+	return res
+}
+
+// object returns the schema of struct type t.
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, omitempty, ok := jsonField(f)
+		if !ok {
+			continue
+		}
+		props[name] = g.schema(f.Type, !omitempty)
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// schema returns the schema of values of type t. Nil pointers, slices
+// and maps encode as null, so they may be null unless the field is
+// omitempty.
+func (g *schemaGen) schema(t reflect.Type, nullable bool) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Implements(textMarshalerType):
+		return map[string]any{"type": "string"}
+	}
+	if values, ok := enums[t]; ok {
+		return map[string]any{"type": "string", "enum": values}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Pointer:
+		s := g.schema(t.Elem(), false)
+		if nullable {
+			return map[string]any{"anyOf": []any{s, map[string]any{"type": "null"}}}
+		}
+		return s
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": orNull("array", nullable && t.Kind() == reflect.Slice), "items": g.schema(t.Elem(), false)}
+	case reflect.Map:
+		// Keys are strings in JSON, including the slots of ClockState.
+		return map[string]any{"type": orNull("object", nullable), "additionalProperties": g.schema(t.Elem(), false)}
+	case reflect.Struct:
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = nil // placeholder against recursion
+			g.defs[t.Name()] = g.object(t)
+		}
+		return ref(t.Name())
+	}
+	return map[string]any{}
+}
+
+func orNull(typ string, nullable bool) any {
+	if nullable {
+		return []string{typ, "null"}
+	}
+	return typ
+}
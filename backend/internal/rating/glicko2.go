@@ -0,0 +1,120 @@
+// Package rating implements the Glicko-2 rating system
+// (http://www.glicko.net/glicko/glicko2.pdf). Every game is its own
+// rating period, so ratings move after each result.
+package rating
+
+import "math"
+
+const (
+	// scale converts between the Glicko and Glicko-2 scales.
+	scale = 173.7178
+	// tau constrains how fast volatility changes.
+	tau = 0.5
+	// epsilon is the convergence tolerance of the volatility iteration.
+	epsilon = 0.000001
+)
+
+// Initial is the rating of a player without rated games.
+var Initial = Rating{Rating: 1500, RD: 350, Volatility: 0.06}
+
+// Rating is a player's strength estimate: the rating, its deviation (how
+// uncertain the rating is) and the volatility (how erratic results are).
+type Rating struct {
+	Rating     float64
+	RD         float64
+	Volatility float64
+}
+
+// Scores of a game from one player's point of view.
+const (
+	Loss = 0.0
+	Draw = 0.5
+	Win  = 1.0
+)
+
+// Result is one game against opponent, scored Win, Draw or Loss.
+type Result struct {
+	Opponent Rating
+	Score    float64
+}
+
+// Update returns r after the results of one rating period. Without
+// results only the deviation grows.
+func Update(r Rating, results ...Result) Rating {
+	mu := (r.Rating - 1500) / scale
+	phi := r.RD / scale
+	sigma := r.Volatility
+
+	if len(results) == 0 {
+		return Rating{
+			Rating:     r.Rating,
+			RD:         math.Min(math.Sqrt(phi*phi+sigma*sigma)*scale, Initial.RD),
+			Volatility: sigma,
+		}
+	}
+
+	var vInv, sum float64
+	for _, res := range results {
+		muJ := (res.Opponent.Rating - 1500) / scale
+		g := gPhi(res.Opponent.RD / scale)
+		e := expected(mu, muJ, g)
+		vInv += g * g * e * (1 - e)
+		sum += g * (res.Score - e)
+	}
+	v := 1 / vInv
+	delta := v * sum
+
+	sigma = volatility(phi, sigma, v, delta)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * sum
+
+	return Rating{
+		Rating:     mu*scale + 1500,
+		RD:         math.Min(phi*scale, Initial.RD),
+		Volatility: sigma,
+	}
+}
+
+func gPhi(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func expected(mu, muJ, g float64) float64 {
+	return 1 / (1 + math.Exp(-g*(mu-muJ)))
+}
+
+// volatility finds the new volatility with the Illinois algorithm, step 5
+// of the paper.
+func volatility(phi, sigma, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
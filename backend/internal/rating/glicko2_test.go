@@ -0,0 +1,51 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUpdatePaperExample(t *testing.T) {
+	// The worked example from the Glicko-2 paper.
+	player := Rating{Rating: 1500, RD: 200, Volatility: 0.06}
+	got := Update(player,
+		Result{Opponent: Rating{Rating: 1400, RD: 30, Volatility: 0.06}, Score: Win},
+		Result{Opponent: Rating{Rating: 1550, RD: 100, Volatility: 0.06}, Score: Loss},
+		Result{Opponent: Rating{Rating: 1700, RD: 300, Volatility: 0.06}, Score: Loss},
+	)
+	want := Rating{Rating: 1464.06, RD: 151.52, Volatility: 0.05999}
+	if !near(got.Rating, want.Rating, 0.01) || !near(got.RD, want.RD, 0.01) || !near(got.Volatility, want.Volatility, 0.00001) {
+		t.Errorf("Update = %+v, want about %+v", got, want)
+	}
+}
+
+func TestUpdateWithoutResults(t *testing.T) {
+	tests := []struct {
+		name string
+		r    Rating
+		want Rating
+	}{
+		{
+			name: "deviation grows",
+			r:    Rating{Rating: 1500, RD: 200, Volatility: 0.06},
+			want: Rating{Rating: 1500, RD: 200.27, Volatility: 0.06},
+		},
+		{
+			name: "deviation capped at the initial one",
+			r:    Initial,
+			want: Initial,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Update(tt.r)
+			if got.Rating != tt.want.Rating || !near(got.RD, tt.want.RD, 0.01) || got.Volatility != tt.want.Volatility {
+				t.Errorf("Update = %+v, want about %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func near(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance
+}
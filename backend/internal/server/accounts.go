@@ -0,0 +1,273 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"emittr/backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Accounts own usernames. Registering one takes a password; a guest
+// account gets a generated name and no password, so its token is the only
+// way back into it. Either way the response carries a session token that
+// /ws accepts in place of the username parameter, and once an account
+// owns a name nobody can play under it without one.
+
+const (
+	// guestPrefix starts every guest name and no registered one.
+	guestPrefix = "guest-"
+	// Passwords are limited to what bcrypt hashes.
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+var (
+	ErrInvalidUsername    = errors.New("usernames are 3 to 24 letters, digits, '_' or '-'")
+	ErrReservedUsername   = errors.New("username is reserved")
+	ErrInvalidPassword    = fmt.Errorf("passwords are %d to %d bytes long", minPasswordLength, maxPasswordLength)
+	ErrInvalidCredentials = errors.New("wrong username or password")
+	ErrNameRegistered     = errors.New("username belongs to an account; log in to play as it")
+	ErrTokenRequired      = errors.New("bearer token required")
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,24}$`)
+
+// unknownAccountHash is compared against on logins to unknown accounts so
+// they take as long as wrong passwords.
+var unknownAccountHash, _ = bcrypt.GenerateFromPassword([]byte("no such account"), bcrypt.DefaultCost)
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (s *Server) accountsAvailable(c *gin.Context) bool {
+	if s.accounts == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "accounts unavailable"})
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleRegister(c *gin.Context) {
+	if !s.accountsAvailable(c) {
+		return
+	}
+	var req credentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if err := validateRegistration(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("hash password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create account"})
+		return
+	}
+	account := storage.Account{Username: req.Username, PasswordHash: hash, CreatedAt: time.Now().UTC()}
+	err = s.accounts.CreateAccount(c.Request.Context(), account)
+	if errors.Is(err, storage.ErrAccountExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("create account db error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create account"})
+		return
+	}
+	s.respondWithToken(c, http.StatusCreated, account)
+}
+
+func validateRegistration(req credentials) error {
+	if !usernamePattern.MatchString(req.Username) {
+		return ErrInvalidUsername
+	}
+	if strings.HasPrefix(req.Username, guestPrefix) || reservedName(req.Username) {
+		return ErrReservedUsername
+	}
+	if len(req.Password) < minPasswordLength || len(req.Password) > maxPasswordLength {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+func (s *Server) handleLogin(c *gin.Context) {
+	if !s.accountsAvailable(c) {
+		return
+	}
+	var req credentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	account, err := s.accounts.LoadAccount(c.Request.Context(), req.Username)
+	if err != nil && !errors.Is(err, storage.ErrAccountNotFound) {
+		log.Printf("load account db error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log in"})
+		return
+	}
+	hash := account.PasswordHash
+	if len(hash) == 0 {
+		// Unknown and guest accounts have no password to match.
+		hash = unknownAccountHash
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) != nil || len(account.PasswordHash) == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidCredentials.Error()})
+		return
+	}
+	s.respondWithToken(c, http.StatusOK, account)
+}
+
+// handleGuest creates a guest account under a generated name.
+func (s *Server) handleGuest(c *gin.Context) {
+	if !s.accountsAvailable(c) {
+		return
+	}
+	for attempt := 0; attempt < 5; attempt++ {
+		suffix := make([]byte, 4)
+		if _, err := rand.Read(suffix); err != nil {
+			panic(err)
+		}
+		account := storage.Account{Username: guestPrefix + hex.EncodeToString(suffix), Guest: true, CreatedAt: time.Now().UTC()}
+		err := s.accounts.CreateAccount(c.Request.Context(), account)
+		if errors.Is(err, storage.ErrAccountExists) {
+			continue
+		}
+		if err != nil {
+			log.Printf("create guest db error: %v", err)
+			break
+		}
+		s.respondWithToken(c, http.StatusCreated, account)
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create guest account"})
+}
+
+// handleMe returns the account of the bearer token.
+func (s *Server) handleMe(c *gin.Context) {
+	if !s.accountsAvailable(c) {
+		return
+	}
+	username, ok := s.bearer(c)
+	if !ok {
+		return
+	}
+	account, err := s.accounts.LoadAccount(c.Request.Context(), username)
+	if errors.Is(err, storage.ErrAccountNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("load account db error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load account"})
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+// bearer returns the username of the session or account token in the
+// Authorization header, checked the way /ws checks tokens, or answers 401.
+func (s *Server) bearer(c *gin.Context) (string, bool) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": ErrTokenRequired.Error()})
+		return "", false
+	}
+	claims, err := s.sessions.verify(token, time.Now())
+	if err == nil {
+		err = s.checkTokenAccount(c.Request.Context(), claims)
+	}
+	if err != nil {
+		s.refuseIdentity(c, err)
+		return "", false
+	}
+	return claims.Username, true
+}
+
+func (s *Server) respondWithToken(c *gin.Context, status int, account storage.Account) {
+	now := time.Now()
+	c.JSON(status, gin.H{
+		"username":  account.Username,
+		"guest":     account.Guest,
+		"token":     s.sessions.issue(account.Username, now),
+		"expiresAt": now.Add(s.sessions.ttl).UTC(),
+	})
+}
+
+// reservedName reports whether username is one the server plays under
+// itself: the bot's, which names its seat in every bot game.
+func reservedName(username string) bool {
+	return strings.EqualFold(username, "bot")
+}
+
+// checkNameFree returns ErrReservedUsername if nobody may play as
+// username, and ErrNameRegistered if it may only be played with a token:
+// it belongs to an account or is a guest name.
+func (s *Server) checkNameFree(ctx context.Context, username string) error {
+	if reservedName(username) {
+		return ErrReservedUsername
+	}
+	if strings.HasPrefix(username, guestPrefix) {
+		return ErrNameRegistered
+	}
+	if s.accounts == nil {
+		return nil
+	}
+	_, err := s.accounts.LoadAccount(ctx, username)
+	if err == nil {
+		return ErrNameRegistered
+	}
+	if errors.Is(err, storage.ErrAccountNotFound) {
+		return nil
+	}
+	return err
+}
+
+// checkTokenAccount rejects tokens issued for a username before an
+// account took it, so whoever played under the name earlier cannot keep
+// using it.
+func (s *Server) checkTokenAccount(ctx context.Context, claims sessionClaims) error {
+	if s.accounts == nil {
+		return nil
+	}
+	account, err := s.accounts.LoadAccount(ctx, claims.Username)
+	if errors.Is(err, storage.ErrAccountNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if claims.IssuedAt < account.CreatedAt.Unix() {
+		return ErrInvalidSession
+	}
+	return nil
+}
+
+// refuseIdentity answers a websocket request whose identity check failed.
+func (s *Server) refuseIdentity(c *gin.Context, err error) {
+	if errors.Is(err, ErrReservedUsername) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, ErrInvalidSession) || errors.Is(err, ErrNameRegistered) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("load account db error: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check account"})
+}
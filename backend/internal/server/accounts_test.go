@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"emittr/backend/internal/storage"
+)
+
+func TestReservedBotName(t *testing.T) {
+	s := New(Config{BotFallbackAfter: time.Hour, ReconnectWindow: time.Minute, Accounts: storage.NewMemoryStore()})
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{"connect", http.MethodGet, "/ws?username=bot", ""},
+		{"connect in other case", http.MethodGet, "/ws?username=BoT", ""},
+		{"register", http.MethodPost, "/accounts/register", `{"username":"Bot","password":"long enough"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, req)
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), ErrReservedUsername.Error()) {
+				t.Fatalf("%s %s = %d %s, want 400 %q", tt.method, tt.target, rec.Code, rec.Body, ErrReservedUsername)
+			}
+		})
+	}
+}
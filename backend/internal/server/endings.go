@@ -0,0 +1,55 @@
+package server
+
+import (
+	"emittr/backend/internal/game"
+	"emittr/backend/internal/protocol"
+)
+
+// resign ends the client's game as a loss for them.
+func (s *Server) resign(c *wsClient) {
+	g, err := s.manager.Resign(s.manager.GameForUser(c.username, c.gameID), c.username)
+	if err != nil {
+		c.sendMessage(protocol.ErrorFor(err))
+		return
+	}
+	s.pushState(g.ID)
+}
+
+// offerDraw passes a draw offer on to the opponent, or ends the game if
+// they had already offered one.
+func (s *Server) offerDraw(c *wsClient) {
+	g, err := s.manager.OfferDraw(s.manager.GameForUser(c.username, c.gameID), c.username)
+	if err != nil {
+		c.sendMessage(protocol.ErrorFor(err))
+		return
+	}
+	v, ok := s.manager.View(g.ID)
+	if !ok {
+		return
+	}
+	if v.Status == game.StatusFinished {
+		s.pushState(v.ID)
+		return
+	}
+	s.sendToUser(findOpponent(v, c.username), protocol.DrawOffer{GameID: v.ID, From: c.username})
+}
+
+func (s *Server) acceptDraw(c *wsClient) {
+	g, err := s.manager.AcceptDraw(s.manager.GameForUser(c.username, c.gameID), c.username)
+	if err != nil {
+		c.sendMessage(protocol.ErrorFor(err))
+		return
+	}
+	s.pushState(g.ID)
+}
+
+func (s *Server) declineDraw(c *wsClient) {
+	g, err := s.manager.DeclineDraw(s.manager.GameForUser(c.username, c.gameID), c.username)
+	if err != nil {
+		c.sendMessage(protocol.ErrorFor(err))
+		return
+	}
+	if v, ok := s.manager.View(g.ID); ok {
+		s.sendToUser(findOpponent(v, c.username), protocol.DrawDeclined{GameID: v.ID, By: c.username})
+	}
+}
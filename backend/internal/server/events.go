@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"emittr/backend/internal/game"
+	"emittr/backend/internal/storage"
+)
+
+// The manager's event log is the source of truth for every game. The
+// server appends each event to the event store and then runs the
+// projections in log order on a single goroutine: they keep their own
+// copy of each game, rebuilt from the events alone, and feed storage,
+// ratings and analytics from it, so those can never disagree with the
+// log.
+
+// eventQueue buffers events from the manager, which records them with
+// its lock held, for the projection goroutine.
+type eventQueue struct {
+	mu      sync.Mutex
+	pending []game.Event
+	wake    chan struct{}
+	closed  bool
+	// done is closed once the projections handled the last event.
+	done chan struct{}
+}
+
+func newEventQueue() *eventQueue {
+	return &eventQueue{wake: make(chan struct{}, 1), done: make(chan struct{})}
+}
+
+func (q *eventQueue) push(e game.Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		log.Printf("event %d of game %s dropped during shutdown", e.Seq, e.GameID)
+		return
+	}
+	q.pending = append(q.pending, e)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close stops the queue taking events; the projections finish the
+// pending ones and then close done.
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.wake)
+	}
+}
+
+func (q *eventQueue) drain() []game.Event {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	batch := q.pending
+	q.pending = nil
+	return batch
+}
+
+// runProjections consumes the event queue until it is closed and
+// drained.
+func (s *Server) runProjections() {
+	defer close(s.events.done)
+	for range s.events.wake {
+		s.projectPending()
+	}
+	// The last events may have shared a wake-up with the close.
+	s.projectPending()
+}
+
+func (s *Server) projectPending() {
+	for _, e := range s.events.drain() {
+		s.appendEvent(e)
+		s.project(e)
+	}
+}
+
+func (s *Server) appendEvent(e game.Event) {
+	if s.eventLog == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("encode event %d of game %s failed: %v", e.Seq, e.GameID, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.eventLog.AppendEvent(ctx, e.GameID, e.Seq, data); err != nil {
+		log.Printf("append event %d of game %s failed: %v", e.Seq, e.GameID, err)
+	}
+}
+
+// project applies e to the projections' copy of its game and updates the
+// read models that depend on it.
+func (s *Server) project(e game.Event) {
+	g, ok := s.projected[e.GameID]
+	switch {
+	case e.Type == game.EventGameCreated || e.Type == game.EventGameRestored:
+		g = &game.GameState{ID: e.GameID}
+		s.projected[e.GameID] = g
+	case !ok:
+		// Rematch events arrive after the game left the projections.
+		return
+	}
+	if err := g.Apply(e); err != nil {
+		log.Printf("projection of game %s stopped: %v", e.GameID, err)
+		delete(s.projected, e.GameID)
+		return
+	}
+	s.publishEvent(e, g)
+	if e.Type == game.EventGameFinished {
+		s.projectFinished(g)
+		delete(s.projected, e.GameID)
+	}
+}
+
+// projectFinished records a finished game in storage, rates it and tells
+// the players about results they did not cause themselves.
+func (s *Server) projectFinished(g *game.GameState) {
+	if g.Reason == game.ReasonTimeout || g.Reason == game.ReasonForfeit {
+		// Nobody moved, so the players have not heard of the result yet.
+		s.pushState(g.ID)
+	}
+	if g.Winner != "" && g.Winner != "bot" {
+		s.winMu.Lock()
+		s.inMemoryWins[g.Winner]++
+		s.winMu.Unlock()
+	}
+	if s.store != nil {
+		_ = s.store.SaveGame(context.Background(), CompletedGame(g))
+		s.updateRatings(g)
+	}
+}
+
+// publishEvent sends e to analytics under its own type, with the state of
+// the game after it.
+func (s *Server) publishEvent(e game.Event, g *game.GameState) {
+	if s.analytics == nil {
+		return
+	}
+	payload := map[string]any{
+		"gameId":  g.ID,
+		"seq":     e.Seq,
+		"status":  g.Status,
+		"winner":  g.Winner,
+		"reason":  g.Reason,
+		"players": humanPlayers(g),
+	}
+	switch e.Type {
+	case game.EventGameCreated:
+		payload["rules"] = g.Rules
+		payload["timeControl"] = e.Created.TimeControl
+	case game.EventMovePlayed:
+		payload["move"] = g.Moves[len(g.Moves)-1]
+	case game.EventGameFinished:
+		players := make([]string, 0, len(g.Players))
+		for uname := range g.Players {
+			players = append(players, uname)
+		}
+		payload["players"] = players
+		payload["rules"] = g.Rules
+		payload["duration"] = g.EndedAt.Sub(g.StartedAt).Seconds()
+		payload["startedAt"] = g.StartedAt
+		payload["endedAt"] = g.EndedAt
+	}
+	if e.Player != "" {
+		payload["player"] = e.Player
+	}
+	if e.Next != "" {
+		payload["next"] = e.Next
+	}
+	s.analytics.Publish(context.Background(), string(e.Type), payload)
+}
+
+func humanPlayers(g *game.GameState) []string {
+	players := make([]string, 0, len(g.Players))
+	for uname, p := range g.Players {
+		if !p.IsBot {
+			players = append(players, uname)
+		}
+	}
+	return players
+}
+
+// CompletedGame converts a finished game into its stored form.
+func CompletedGame(g *game.GameState) storage.CompletedGame {
+	player1, player2 := slotUsernames(g)
+	return storage.CompletedGame{
+		ID:        g.ID,
+		Player1:   player1,
+		Player2:   player2,
+		Winner:    g.Winner,
+		Status:    g.Status,
+		Reason:    string(g.Reason),
+		Columns:   g.Rules.Columns,
+		Rows:      g.Rules.Rows,
+		Connect:   g.Rules.Connect,
+		Variant:   g.Rules.Variant,
+		StartedAt: g.StartedAt,
+		EndedAt:   g.EndedAt,
+		Moves:     completedMoves(g.Moves),
+	}
+}
+
+// DecodeEvents reads a game's log as stored in an event store.
+func DecodeEvents(docs [][]byte) ([]game.Event, error) {
+	events := make([]game.Event, len(docs))
+	for i, data := range docs {
+		if err := json.Unmarshal(data, &events[i]); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
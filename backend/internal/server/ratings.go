@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"emittr/backend/internal/game"
+	"emittr/backend/internal/protocol"
+	"emittr/backend/internal/rating"
+	"emittr/backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// updateRatings rates a finished game between two people and tells both
+// players their new rating. Games against the bot are not rated.
+func (s *Server) updateRatings(g *game.GameState) {
+	player1, player2 := slotUsernames(g)
+	if player1 == "" || player2 == "" || g.Players[player1].IsBot || g.Players[player2].IsBot {
+		return
+	}
+	// Serialize updates so a player finishing two games at once keeps
+	// both results.
+	s.ratingMu.Lock()
+	defer s.ratingMu.Unlock()
+
+	ctx := context.Background()
+	current, err := s.store.LoadRatings(ctx, player1, player2)
+	if err != nil {
+		log.Printf("load ratings for game %s failed: %v", g.ID, err)
+		return
+	}
+	before := map[string]storage.PlayerRating{
+		player1: ratingOf(current, player1),
+		player2: ratingOf(current, player2),
+	}
+	updated := make([]storage.PlayerRating, 0, 2)
+	for _, pair := range [][2]string{{player1, player2}, {player2, player1}} {
+		me, opponent := before[pair[0]], before[pair[1]]
+		score := rating.Draw
+		switch g.Winner {
+		case me.Username:
+			score = rating.Win
+			me.Wins++
+		case opponent.Username:
+			score = rating.Loss
+			me.Losses++
+		default:
+			me.Draws++
+		}
+		next := rating.Update(glicko(me), rating.Result{Opponent: glicko(opponent), Score: score})
+		me.Rating, me.RD, me.Volatility = next.Rating, next.RD, next.Volatility
+		me.Games++
+		me.UpdatedAt = g.EndedAt
+		updated = append(updated, me)
+	}
+	if err := s.store.SaveRatings(ctx, g.ID, updated); err != nil {
+		log.Printf("save ratings for game %s failed: %v", g.ID, err)
+		return
+	}
+	for _, r := range updated {
+		s.sendToUser(r.Username, protocol.Rating{
+			GameID: g.ID,
+			Rating: r.Rating,
+			RD:     r.RD,
+			Change: r.Rating - before[r.Username].Rating,
+			Games:  r.Games,
+		})
+	}
+}
+
+func ratingOf(ratings map[string]storage.PlayerRating, username string) storage.PlayerRating {
+	if r, ok := ratings[username]; ok {
+		return r
+	}
+	return storage.PlayerRating{
+		Username:   username,
+		Rating:     rating.Initial.Rating,
+		RD:         rating.Initial.RD,
+		Volatility: rating.Initial.Volatility,
+	}
+}
+
+func glicko(r storage.PlayerRating) rating.Rating {
+	return rating.Rating{Rating: r.Rating, RD: r.RD, Volatility: r.Volatility}
+}
+
+// handleRatingHistory returns a player's ratings after their latest rated
+// games, newest first.
+func (s *Server) handleRatingHistory(c *gin.Context) {
+	if s.store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ratings unavailable"})
+		return
+	}
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		limit = min(n, 500)
+	}
+	username := c.Param("username")
+	ratings, err := s.store.LoadRatings(c.Request.Context(), username)
+	if err == nil {
+		var history []storage.RatingPoint
+		history, err = s.store.RatingHistory(c.Request.Context(), username, limit)
+		if err == nil {
+			c.JSON(http.StatusOK, gin.H{"rating": ratingOf(ratings, username), "history": history})
+			return
+		}
+	}
+	log.Printf("rating history db error: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load ratings"})
+}
+
+// playerRating returns the rating matchmaking pairs username by.
+func (s *Server) playerRating(username string) float64 {
+	if s.store == nil {
+		return rating.Initial.Rating
+	}
+	ratings, err := s.store.LoadRatings(context.Background(), username)
+	if err != nil {
+		log.Printf("load rating of %s failed: %v", username, err)
+		return rating.Initial.Rating
+	}
+	return ratingOf(ratings, username).Rating
+}
@@ -0,0 +1,42 @@
+package server
+
+import "emittr/backend/internal/protocol"
+
+// requestRematch offers or accepts a rematch of the client's last game.
+// The opponent is asked with a rematch_offer message; once both agree the
+// new game starts for both players like any other.
+func (s *Server) requestRematch(c *wsClient) {
+	gameID := s.manager.GameForUser(c.username, c.gameID)
+	next, err := s.manager.RequestRematch(gameID, c.username)
+	if err != nil {
+		c.sendMessage(protocol.ErrorFor(err))
+		return
+	}
+	if next == nil {
+		c.sendMessage(protocol.Waiting{Message: "waiting for opponent to accept the rematch"})
+		if v, ok := s.manager.View(gameID); ok {
+			s.sendToUser(findOpponent(v, c.username), protocol.RematchOffer{GameID: gameID, From: c.username})
+		}
+		return
+	}
+	c.gameID = next.ID
+	for uname, p := range next.Players {
+		if !p.IsBot {
+			s.pushInit(next.ID, uname)
+		}
+	}
+	if v, ok := s.manager.View(next.ID); ok && v.BotToMove() {
+		s.playBotTurn(next.ID)
+	}
+}
+
+func (s *Server) declineRematch(c *wsClient) {
+	gameID := s.manager.GameForUser(c.username, c.gameID)
+	if err := s.manager.DeclineRematch(gameID, c.username); err != nil {
+		c.sendMessage(protocol.ErrorFor(err))
+		return
+	}
+	if v, ok := s.manager.View(gameID); ok {
+		s.sendToUser(findOpponent(v, c.username), protocol.RematchDeclined{GameID: gameID, By: c.username})
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"emittr/backend/internal/game"
+	"emittr/backend/internal/protocol"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRoom is the room query value that opens a fresh room on connect.
+const newRoom = "NEW"
+
+type createRoomRequest struct {
+	Columns int    `json:"columns"`
+	Rows    int    `json:"rows"`
+	Connect int    `json:"connect"`
+	Variant string `json:"variant"`
+	// TimeControl is "minutes+seconds", empty for an untimed game.
+	TimeControl string `json:"timeControl"`
+}
+
+// handleCreateRoom opens a private room for the player of the bearer
+// token. Rules fields left out of the body keep their standard value.
+func (s *Server) handleCreateRoom(c *gin.Context) {
+	username, ok := s.bearer(c)
+	if !ok {
+		return
+	}
+	var req createRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	rules := game.StandardRules
+	if req.Columns != 0 {
+		rules.Columns = req.Columns
+	}
+	if req.Rows != 0 {
+		rules.Rows = req.Rows
+	}
+	if req.Connect != 0 {
+		rules.Connect = req.Connect
+	}
+	if req.Variant != "" {
+		rules.Variant = req.Variant
+	}
+	if err := rules.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	clock, err := game.ParseTimeControl(req.TimeControl)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	room, err := s.manager.CreateRoom(username, rules, clock)
+	if err != nil {
+		c.JSON(roomErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, room)
+}
+
+func (s *Server) handleGetRoom(c *gin.Context) {
+	room, ok := s.manager.Room(strings.ToUpper(c.Param("code")))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": game.ErrRoomNotFound.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, room)
+}
+
+// handleJoinRoom starts the game of a room for the player of the bearer
+// token. The guest then connects to /ws with the returned gameId; a host
+// already connected gets its init right away.
+func (s *Server) handleJoinRoom(c *gin.Context) {
+	username, ok := s.bearer(c)
+	if !ok {
+		return
+	}
+	g, err := s.manager.JoinRoom(strings.ToUpper(c.Param("code")), username)
+	if err != nil {
+		c.JSON(roomErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	v, ok := s.manager.View(g.ID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": game.ErrGameNotFound.Error()})
+		return
+	}
+	s.pushRoomInit(v)
+	c.JSON(http.StatusOK, gin.H{
+		"gameId":   v.ID,
+		"room":     v.Room,
+		"rules":    v.Rules,
+		"clock":    v.Clock,
+		"slot":     v.Players[username].Slot,
+		"opponent": findOpponent(v, username),
+	})
+}
+
+// enterRoom runs the websocket handshake for ?room=: "new" opens a room,
+// the host of an open room waits in it and anyone else joins it.
+func (s *Server) enterRoom(c *wsClient) {
+	if c.room == newRoom {
+		room, err := s.manager.CreateRoom(c.username, c.rules, c.clock)
+		if err != nil {
+			c.sendMessage(protocol.ErrorFor(err))
+			return
+		}
+		c.sendWaitingRoom(room)
+		return
+	}
+	if room, ok := s.manager.Room(c.room); ok && room.Host == c.username {
+		c.sendWaitingRoom(room)
+		return
+	}
+	g, err := s.manager.JoinRoom(c.room, c.username)
+	if err != nil {
+		c.sendMessage(protocol.ErrorFor(err))
+		return
+	}
+	if v, ok := s.manager.View(g.ID); ok {
+		s.pushRoomInit(v)
+	}
+}
+
+func (c *wsClient) sendWaitingRoom(room *game.Room) {
+	c.sendMessage(protocol.Waiting{
+		Message:     "waiting for a friend to join",
+		Room:        room.Code,
+		Rules:       &room.Rules,
+		TimeControl: &room.TimeControl,
+	})
+}
+
+func (s *Server) pushRoomInit(v game.View) {
+	for uname := range v.Players {
+		s.pushInit(v.ID, uname)
+	}
+}
+
+func roomErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, game.ErrRoomNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, game.ErrOwnRoom), errors.Is(err, game.ErrAlreadyPlaying):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
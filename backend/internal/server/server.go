@@ -2,15 +2,20 @@ package server
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"emittr/backend/internal/analytics"
 	"emittr/backend/internal/game"
+	"emittr/backend/internal/protocol"
 	"emittr/backend/internal/storage"
 
 	"github.com/gin-gonic/gin"
@@ -19,15 +24,29 @@ import (
 
 type Server struct {
 	router          *gin.Engine
+	httpServer      *http.Server
 	manager         *game.Manager
 	store           storage.Store
 	analytics       *analytics.Producer
 	inMemoryWins    map[string]int
 	winMu           sync.Mutex
+	ratingMu        sync.Mutex
 	connections     map[string]*wsClient
+	spectators      map[string]map[*wsClient]struct{} // by game ID
 	connMu          sync.RWMutex
 	botDelay        time.Duration
 	reconnectWindow time.Duration
+	botMoveTimeout  time.Duration
+	searchTable     *game.TranspositionTable
+	openingBook     *game.OpeningBook
+	snapshots       *snapshotWriter
+	sessions        *sessions
+	accounts        storage.AccountStore
+	events          *eventQueue
+	eventLog        storage.EventStore
+	// projected holds the projections' copy of every game in progress;
+	// only runProjections touches it.
+	projected map[string]*game.GameState
 }
 
 type Config struct {
@@ -35,6 +54,27 @@ type Config struct {
 	ReconnectWindow  time.Duration
 	Store            storage.Store
 	Analytics        *analytics.Producer
+	// BotMoveTimeout bounds how long a bot strategy may think per move;
+	// zero lets it search to its configured depth.
+	BotMoveTimeout time.Duration
+	// SearchTableSize is the number of transposition table entries shared
+	// by bot searches; zero disables the table.
+	SearchTableSize int
+	OpeningBook     *game.OpeningBook
+	// Solver, when set, plays for bots at the perfect level in the
+	// positions it can solve in time.
+	Solver game.Solver
+	// Snapshots, when set, keeps the games in progress across restarts.
+	Snapshots storage.SnapshotStore
+	// Events, when set, keeps the event log of every game.
+	Events storage.EventStore
+	// SessionSecret signs session tokens; when empty a random key is
+	// used and tokens do not survive a restart. SessionTTL defaults to
+	// DefaultSessionTTL.
+	SessionSecret string
+	SessionTTL    time.Duration
+	// Accounts, when set, lets players register names and play as guests.
+	Accounts storage.AccountStore
 }
 
 func New(cfg Config) *Server {
@@ -42,31 +82,96 @@ func New(cfg Config) *Server {
 	router := gin.Default()
 	s := &Server{
 		router:          router,
-		manager:         game.NewManager(cfg.ReconnectWindow, nil),
+		httpServer:      &http.Server{Handler: router},
 		store:           cfg.Store,
 		analytics:       cfg.Analytics,
 		inMemoryWins:    make(map[string]int),
 		connections:     make(map[string]*wsClient),
+		spectators:      make(map[string]map[*wsClient]struct{}),
 		botDelay:        cfg.BotFallbackAfter,
+		botMoveTimeout:  cfg.BotMoveTimeout,
 		reconnectWindow: cfg.ReconnectWindow,
+		searchTable:     game.NewTranspositionTable(cfg.SearchTableSize),
+		openingBook:     cfg.OpeningBook,
+		events:          newEventQueue(),
+		eventLog:        cfg.Events,
+		projected:       make(map[string]*game.GameState),
+		sessions:        newSessions(cfg.SessionSecret, cfg.SessionTTL),
+		accounts:        cfg.Accounts,
+	}
+	s.manager = game.NewManager(cfg.ReconnectWindow, s.events.push)
+	s.manager.SetTranspositionTable(s.searchTable)
+	s.manager.SetOpeningBook(cfg.OpeningBook)
+	s.manager.SetSolver(cfg.Solver)
+	if cfg.Snapshots != nil {
+		s.restoreSnapshots(cfg.Snapshots)
+		s.snapshots = newSnapshotWriter(cfg.Snapshots)
+		s.manager.SetSnapshotter(s.snapshots.enqueue)
 	}
-	s.manager = game.NewManager(cfg.ReconnectWindow, s.onFinish)
 
 	router.GET("/health", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"status": "ok"}) })
 	router.GET("/leaderboard", s.handleLeaderboard)
+	router.GET("/players/:username/ratings", s.handleRatingHistory)
+	router.GET("/bot/stats", s.handleBotStats)
+	router.GET("/bot/strategies", func(c *gin.Context) { c.JSON(http.StatusOK, game.Strategies()) })
+	router.GET("/games/live", s.handleLiveGames)
+	router.GET("/games/:id", s.handleGetGame)
+	router.GET("/games/:id/replay", s.handleReplay)
+	router.GET("/games/:id/export", s.handleExport)
+	router.POST("/rooms", s.handleCreateRoom)
+	router.GET("/rooms/:code", s.handleGetRoom)
+	router.POST("/rooms/:code/join", s.handleJoinRoom)
+	router.POST("/accounts/register", s.handleRegister)
+	router.POST("/accounts/login", s.handleLogin)
+	router.POST("/accounts/guest", s.handleGuest)
+	router.GET("/accounts/me", s.handleMe)
 	router.GET("/ws", s.handleWS)
-	
+	router.GET("/protocol/schema", s.handleProtocolSchema)
+
 	// Serve frontend static files
 	frontendPath := filepath.Join("..", "frontend")
 	router.StaticFile("/", filepath.Join(frontendPath, "index.html"))
 	router.Static("/static", frontendPath)
-	
+
 	return s
 }
 
+// Run serves on addr until Shutdown is called.
 func (s *Server) Run(addr string) error {
+	if s.snapshots != nil {
+		go s.snapshots.run()
+	}
+	go s.runProjections()
+	s.resumeBotTurns()
 	go s.sweeper()
-	return s.router.Run(addr)
+	go s.matchmaker()
+	s.httpServer.Addr = addr
+	if err := s.httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops taking requests, then waits until the events and
+// snapshots recorded so far are stored or ctx ends. Events of
+// connections still open afterwards are dropped.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.httpServer.Shutdown(ctx)
+	s.events.close()
+	select {
+	case <-s.events.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if s.snapshots != nil {
+		s.snapshots.close()
+		select {
+		case <-s.snapshots.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
 }
 
 func (s *Server) sweeper() {
@@ -76,6 +181,18 @@ func (s *Server) sweeper() {
 	}
 }
 
+// matchmaker pairs waiting players as their match windows widen.
+func (s *Server) matchmaker() {
+	ticker := time.NewTicker(time.Second)
+	for range ticker.C {
+		for _, g := range s.manager.MatchQueue() {
+			for uname := range g.Players {
+				s.pushInit(g.ID, uname)
+			}
+		}
+	}
+}
+
 func (s *Server) handleLeaderboard(c *gin.Context) {
 	ctx := c.Request.Context()
 	if s.store != nil {
@@ -100,12 +217,180 @@ func (s *Server) handleLeaderboard(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
+func (s *Server) loadGame(c *gin.Context) (storage.CompletedGame, bool) {
+	if s.store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "game history unavailable"})
+		return storage.CompletedGame{}, false
+	}
+	g, err := s.store.LoadGame(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return storage.CompletedGame{}, false
+	}
+	if err != nil {
+		log.Printf("load game db error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load game"})
+		return storage.CompletedGame{}, false
+	}
+	return g, true
+}
+
+func (s *Server) handleGetGame(c *gin.Context) {
+	if g, ok := s.loadGame(c); ok {
+		c.JSON(http.StatusOK, g)
+	}
+}
+
+// handleReplay returns the board after every ply so clients can step
+// through a finished game without reimplementing the rules.
+func (s *Server) handleReplay(c *gin.Context) {
+	g, ok := s.loadGame(c)
+	if !ok {
+		return
+	}
+	boards, err := game.Replay(storedRules(g), recordedMoves(g.Moves))
+	if err != nil {
+		log.Printf("replay of game %s failed: %v", g.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "stored moves are inconsistent"})
+		return
+	}
+	type ply struct {
+		Ply   int           `json:"ply"`
+		Move  *storage.Move `json:"move,omitempty"`
+		Board game.Board    `json:"board"`
+	}
+	plies := make([]ply, len(boards))
+	for i, b := range boards {
+		plies[i] = ply{Ply: i, Board: b}
+		if i > 0 {
+			plies[i].Move = &g.Moves[i-1]
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      g.ID,
+		"player1": g.Player1,
+		"player2": g.Player2,
+		"winner":  g.Winner,
+		"status":  g.Status,
+		"reason":  g.Reason,
+		"rules":   storedRules(g),
+		"plies":   plies,
+	})
+}
+
+// storedRules returns the rules of a stored game; games saved before
+// rules were recorded were played under the standard ones.
+func storedRules(g storage.CompletedGame) game.Rules {
+	if g.Columns == 0 {
+		return game.StandardRules
+	}
+	rules := game.Rules{Columns: g.Columns, Rows: g.Rows, Connect: g.Connect, Variant: g.Variant}
+	if rules.Variant == "" {
+		rules.Variant = game.VariantNormal
+	}
+	return rules
+}
+
+func recordedMoves(moves []storage.Move) []game.MoveRecord {
+	res := make([]game.MoveRecord, len(moves))
+	for i, m := range moves {
+		res[i] = game.MoveRecord{
+			Number:   m.Ply,
+			Action:   game.Action(m.Action),
+			Column:   m.Column,
+			Row:      m.Row,
+			Slot:     m.Player,
+			PlayedAt: m.PlayedAt,
+		}
+	}
+	return res
+}
+
+// handleExport serves a finished game in game notation, or with
+// ?format=position just its final position string.
+func (s *Server) handleExport(c *gin.Context) {
+	g, ok := s.loadGame(c)
+	if !ok {
+		return
+	}
+	rec := game.GameRecord{
+		Tags: map[string]string{
+			"Event":  "4 in a Row",
+			"Date":   g.StartedAt.UTC().Format("2006.01.02"),
+			"Red":    g.Player1,
+			"Yellow": g.Player2,
+			"GameId": g.ID,
+		},
+		Rules:  storedRules(g),
+		Moves:  recordedMoves(g.Moves),
+		Result: game.ResultUnfinished,
+	}
+	if g.Reason != "" {
+		rec.Tags["Termination"] = g.Reason
+	}
+	switch {
+	case g.Winner != "" && g.Winner == g.Player1:
+		rec.Result = game.ResultRedWins
+	case g.Winner != "" && g.Winner == g.Player2:
+		rec.Result = game.ResultYellowWins
+	case g.Status == game.StatusFinished && g.Winner == "":
+		rec.Result = game.ResultDraw
+	}
+
+	if c.Query("format") == "position" {
+		board, err := rec.Board()
+		if err != nil {
+			log.Printf("export of game %s failed: %v", g.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "stored moves are inconsistent"})
+			return
+		}
+		toMove := game.CellP1
+		if len(rec.Moves)%2 == 1 {
+			toMove = game.CellP2
+		}
+		c.String(http.StatusOK, game.FormatPosition(board, toMove)+"\n")
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.c4n"`, g.ID))
+	c.String(http.StatusOK, rec.String())
+}
+
+func (s *Server) handleBotStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"transpositionTable": s.searchTable.Stats(),
+		"openingBookEntries": s.openingBook.Len(),
+	})
+}
+
+// protocolSchema is the JSON Schema of the websocket messages, built on
+// first use.
+var protocolSchema = sync.OnceValue(protocol.Schema)
+
+func (s *Server) handleProtocolSchema(c *gin.Context) {
+	c.Data(http.StatusOK, "application/schema+json", protocolSchema())
+}
+
 type wsClient struct {
-	username string
-	conn     *websocket.Conn
-	send     chan []byte
-	server   *Server
-	gameID   string
+	username  string
+	session   string
+	protocol  int
+	conn      *websocket.Conn
+	send      chan []byte
+	server    *Server
+	gameID    string
+	room      string
+	watch     string
+	rules     game.Rules
+	clock     game.TimeControl
+	botConfig game.BotConfig
+	// heard is when the client last answered a ping or sent a message,
+	// in Unix nanoseconds.
+	heard atomic.Int64
+}
+
+// stale reports whether c has missed answering its pings.
+func (c *wsClient) stale(now time.Time) bool {
+	return now.Sub(time.Unix(0, c.heard.Load())) > staleAfter
 }
 
 var upgrader = websocket.Upgrader{
@@ -115,84 +400,253 @@ var upgrader = websocket.Upgrader{
 }
 
 func (s *Server) handleWS(c *gin.Context) {
-	username := c.Query("username")
+	version, err := protocol.Negotiate(c.Query("protocol"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"code":      protocol.CodeUnsupportedVersion,
+			"supported": protocol.Versions(),
+		})
+		return
+	}
 	requestGameID := c.Query("gameId")
-	if username == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "username required"})
+	if watch := c.Query("watch"); watch != "" {
+		s.handleWatch(c, c.Query("username"), watch, version)
+		return
+	}
+	difficulty, err := game.ParseDifficulty(c.Query("difficulty"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	strategy, err := game.ParseStrategy(c.Query("strategy"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rules, err := parseRules(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// A literal "+" in the query decodes to a space.
+	clock, err := game.ParseTimeControl(strings.ReplaceAll(c.Query("time"), " ", "+"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	room := strings.ToUpper(c.Query("room"))
+	if room != "" && room != newRoom {
+		if _, ok := s.manager.Room(room); !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": game.ErrRoomNotFound.Error()})
+			return
+		}
+	}
+	username, session, takeover, ok := s.authorize(c, requestGameID)
+	if !ok {
 		return
 	}
 
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	client := &wsClient{
+		username:  username,
+		session:   session,
+		protocol:  version,
+		conn:      conn,
+		send:      make(chan []byte, 8),
+		server:    s,
+		gameID:    requestGameID,
+		room:      room,
+		rules:     rules,
+		clock:     clock,
+		botConfig: game.BotConfig{Strategy: strategy, Difficulty: difficulty},
+	}
+	client.heard.Store(time.Now().UnixNano())
+	go client.writePump()
+	if !s.register(client, takeover) {
+		// Lost a race with another connection since authorize.
+		client.sendMessage(protocol.Error{Code: protocol.CodeAlreadyConnected, Message: ErrAlreadyConnected.Error()})
+		close(client.send)
+		return
+	}
+	go client.readPump()
+}
+
+// handleWatch connects a read-only spectator to a game in progress. The
+// username is optional for spectators.
+func (s *Server) handleWatch(c *gin.Context, username, gameID string, version int) {
+	if _, ok := s.manager.View(gameID); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "game not found"})
+		return
+	}
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		return
 	}
 	client := &wsClient{
 		username: username,
+		protocol: version,
 		conn:     conn,
 		send:     make(chan []byte, 8),
 		server:   s,
-		gameID:   requestGameID,
+		watch:    gameID,
 	}
-	s.register(client)
+	s.addSpectator(client)
 
 	go client.writePump()
-	go client.readPump()
+	go client.watchPump()
+}
+
+// parseRules reads the optional columns, rows, connect and variant query
+// parameters; missing ones keep their standard value.
+func parseRules(c *gin.Context) (game.Rules, error) {
+	rules := game.StandardRules
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{
+		{"columns", &rules.Columns},
+		{"rows", &rules.Rows},
+		{"connect", &rules.Connect},
+	} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return game.Rules{}, fmt.Errorf("%w: %s must be a number", game.ErrInvalidRules, p.name)
+		}
+		*p.value = n
+	}
+	if v := c.Query("variant"); v != "" {
+		rules.Variant = v
+	}
+	return rules, rules.Validate()
 }
 
-func (s *Server) register(c *wsClient) {
+// register makes c the connection of its username. A connection the
+// username already has keeps it, unless takeover is set and it is stale:
+// then the old connection is closed, and its read pump finds itself
+// replaced.
+func (s *Server) register(c *wsClient, takeover bool) bool {
 	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	if s.busyLocked(c.username, takeover, time.Now()) {
+		return false
+	}
+	if old, taken := s.connections[c.username]; taken {
+		old.conn.Close()
+	}
 	s.connections[c.username] = c
-	s.connMu.Unlock()
+	return true
 }
 
+// unregister closes c. If c is still the connection of its username, the
+// player leaves the queue and is marked disconnected from their game;
+// this happens under connMu, so a connection taking over the username is
+// registered, and marks the player back, only afterwards.
 func (s *Server) unregister(c *wsClient) {
 	s.connMu.Lock()
-	delete(s.connections, c.username)
+	if s.connections[c.username] == c {
+		delete(s.connections, c.username)
+		s.manager.LeaveQueue(c.username)
+		s.manager.MarkDisconnected(c.username)
+	}
 	s.connMu.Unlock()
 	c.conn.Close()
 }
 
+const (
+	// pingPeriod is how often pings go out, so live connections are
+	// heard from at least that often.
+	pingPeriod = 10 * time.Second
+	// staleAfter is how long a connection may go unheard before a client
+	// holding a token for its username may take it over, well within the
+	// reconnect window.
+	staleAfter = 2 * pingPeriod
+	// pongWait is how long a player's connection may stay silent before
+	// it is dropped, freeing the seat for anyone.
+	pongWait = 60 * time.Second
+)
+
+// writePump sends queued messages and pings until the connection fails or
+// send is closed.
 func (c *wsClient) writePump() {
-	for msg := range c.send {
-		_ = c.conn.WriteMessage(websocket.TextMessage, msg)
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg, ok := <-c.send:
+			if !ok {
+				_ = c.conn.WriteMessage(websocket.CloseMessage, nil)
+				c.conn.Close()
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		}
 	}
 }
 
 func (c *wsClient) readPump() {
 	defer c.server.unregister(c)
 	s := c.server
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.heard.Store(time.Now().UnixNano())
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	c.sendMessage(protocol.Welcome{Protocol: c.protocol})
+	c.sendMessage(protocol.Session{Token: c.session})
+	s.manager.MarkReconnected(c.username)
 
-	var gameState *game.GameState
+	var gameID string
 
 	// Rejoin if gameId provided
 	if c.gameID != "" {
-		if g, ok := s.manager.GetGame(c.gameID); ok {
-			if _, exists := g.Players[c.username]; exists {
-				gameState = g
-				s.pushInit(g, c.username)
-				s.pushState(g)
+		if v, ok := s.manager.View(c.gameID); ok {
+			if _, exists := v.Players[c.username]; exists {
+				gameID = v.ID
+				s.pushInit(v.ID, c.username)
+				s.pushState(v.ID)
 			}
 		}
 	}
-	if gameState == nil {
-		g, _, waiting := s.manager.AssignPlayer(c.username)
+	if gameID == "" && c.room != "" {
+		s.enterRoom(c)
+	} else if gameID == "" {
+		seek := game.Seek{Rules: c.rules, TimeControl: c.clock, Rating: s.playerRating(c.username)}
+		g, _, waiting := s.manager.AssignPlayer(c.username, seek)
 		if waiting {
-			c.sendJSON(map[string]any{"type": "waiting", "message": "waiting for opponent"})
+			c.sendMessage(protocol.Waiting{Message: "waiting for opponent"})
 			time.AfterFunc(s.botDelay, func() {
 				// Only trigger if still unpaired
-				if _, ok := s.manager.GetGameByUser(c.username); !ok {
-					g := s.manager.StartBotGame(c.username)
-					s.pushInit(g, c.username)
-					if g.Bot != nil && g.Turn == game.CellP2 {
-						s.playBotTurn(g)
+				if s.manager.LeaveQueue(c.username) {
+					g, err := s.manager.StartBotGame(c.username, c.rules, c.clock, c.botConfig)
+					if err != nil {
+						c.sendMessage(protocol.ErrorFor(err))
+						return
+					}
+					s.pushInit(g.ID, c.username)
+					if v, ok := s.manager.View(g.ID); ok && v.BotToMove() {
+						s.playBotTurn(g.ID)
 					}
 				}
 			})
 		} else {
-			gameState = g
-			c.server.pushInit(gameState, c.username)
+			gameID = g.ID
+			c.server.pushInit(gameID, c.username)
 			// notify opponent if online
-			for uname, pl := range gameState.Players {
+			for uname, pl := range g.Players {
 				if uname == c.username {
 					continue
 				}
@@ -200,188 +654,217 @@ func (c *wsClient) readPump() {
 					continue
 				}
 				if peer, ok := s.connections[uname]; ok {
-					s.pushInit(gameState, peer.username)
+					s.pushInit(gameID, peer.username)
 				}
 			}
 		}
 	} else {
-		s.pushInit(gameState, c.username)
+		s.pushInit(gameID, c.username)
 	}
 
 	for {
 		_, data, err := c.conn.ReadMessage()
 		if err != nil {
-			s.manager.MarkDisconnected(c.username)
 			return
 		}
-		var msg map[string]any
-		if err := json.Unmarshal(data, &msg); err != nil {
+		c.heard.Store(time.Now().UnixNano())
+		msg, err := protocol.Decode(data)
+		if err != nil {
+			c.sendMessage(protocol.ErrorFor(err))
 			continue
 		}
-		if msg["type"] == "move" {
-			col, ok := msg["column"].(float64)
-			if !ok {
-				continue
-			}
-			move := game.Move{
-				Username: c.username,
-				GameID:   s.manager.GameForUser(c.username, c.gameID),
-				Column:   int(col),
-			}
-			res, g, err := s.manager.HandleMove(move)
-			if err != nil {
-				c.sendJSON(map[string]any{"type": "error", "message": err.Error()})
-				continue
-			}
-			s.broadcastState(g, res)
-			if g.Bot != nil && g.Status == game.StatusActive && g.Turn == g.Players["bot"].Slot {
-				s.playBotTurn(g)
-			}
+		switch msg := msg.(type) {
+		case protocol.Move:
+			s.playMove(c, msg)
+		case protocol.Resign:
+			s.resign(c)
+		case protocol.OfferDraw:
+			s.offerDraw(c)
+		case protocol.AcceptDraw:
+			s.acceptDraw(c)
+		case protocol.DeclineDraw:
+			s.declineDraw(c)
+		case protocol.Rematch:
+			s.requestRematch(c)
+		case protocol.DeclineRematch:
+			s.declineRematch(c)
 		}
 	}
 }
 
-func (s *Server) pushInit(g *game.GameState, username string) {
-	slot := 0
-	if p, ok := g.Players[username]; ok {
-		slot = p.Slot
+func (s *Server) playMove(c *wsClient, msg protocol.Move) {
+	action, err := game.ParseAction(string(msg.Action))
+	if err != nil {
+		c.sendMessage(protocol.ErrorFor(err))
+		return
+	}
+	move := game.Move{
+		Username: c.username,
+		GameID:   s.manager.GameForUser(c.username, c.gameID),
+		Action:   action,
+		Column:   msg.Column,
+	}
+	_, g, err := s.manager.HandleMove(move)
+	if err != nil {
+		c.sendMessage(protocol.ErrorFor(err))
+		return
 	}
-	payload := map[string]any{
-		"type":      "init",
-		"gameId":    g.ID,
-		"board":     g.Board,
-		"turn":      g.Turn,
-		"you":       username,
-		"slot":      slot,
-		"opponent":  s.findOpponent(g, username),
-		"status":    g.Status,
-		"winner":    g.Winner,
-		"timestamp": time.Now().UTC(),
+	s.pushState(g.ID)
+	if v, ok := s.manager.View(g.ID); ok && v.BotToMove() {
+		s.playBotTurn(g.ID)
 	}
-	s.sendToUser(username, payload)
 }
 
-func (s *Server) pushState(g *game.GameState) {
-	res := game.MoveResult{Board: g.Board}
-	s.broadcastState(g, res)
+func (s *Server) pushInit(gameID, username string) {
+	v, ok := s.manager.View(gameID)
+	if !ok {
+		return
+	}
+	msg := protocol.Init{
+		GameID:     v.ID,
+		Rules:      v.Rules,
+		Board:      v.Board,
+		Turn:       v.Turn,
+		You:        username,
+		Slot:       v.Players[username].Slot,
+		Opponent:   findOpponent(v, username),
+		Status:     v.Status,
+		Winner:     v.Winner,
+		Reason:     v.Reason,
+		Clock:      v.Clock,
+		Spectators: s.spectatorCount(v.ID),
+		Series:     &v.Series,
+		Timestamp:  time.Now().UTC(),
+	}
+	if v.Bot != nil {
+		msg.Bot = &protocol.Bot{
+			Strategy: v.Bot.Name(),
+			Metadata: v.Bot.Metadata(),
+		}
+	}
+	s.sendToUser(username, msg)
 }
 
-func (s *Server) broadcastState(g *game.GameState, res game.MoveResult) {
-	payload := map[string]any{
-		"type":   "state",
-		"board":  res.Board,
-		"turn":   g.Turn,
-		"status": g.Status,
-		"winner": g.Winner,
+// pushState sends the current state of gameID to its players and
+// spectators.
+func (s *Server) pushState(gameID string) {
+	v, ok := s.manager.View(gameID)
+	if !ok {
+		return
 	}
-	for uname := range g.Players {
+	msg := protocol.State{
+		Board:  v.Board,
+		Turn:   v.Turn,
+		Status: v.Status,
+		Winner: v.Winner,
+		Reason: v.Reason,
+		Moves:  v.Moves,
+		Clock:  v.Clock,
+		Series: v.Series,
+	}
+	for uname := range v.Players {
 		if uname == "bot" {
 			continue
 		}
-		s.sendToUser(uname, payload)
-	}
-	if s.analytics != nil {
-		players := make([]string, 0, len(g.Players))
-		for uname := range g.Players {
-			if uname != "bot" {
-				players = append(players, uname)
-			}
-		}
-		s.analytics.Publish(context.Background(), "move_played", map[string]any{
-			"gameId":  g.ID,
-			"status":  g.Status,
-			"winner":  g.Winner,
-			"players": players,
-		})
+		s.sendToUser(uname, msg)
 	}
+	s.sendToSpectators(v.ID, msg)
 }
 
-func (s *Server) sendToUser(username string, payload map[string]any) {
+func (s *Server) sendToUser(username string, msg protocol.Message) {
 	s.connMu.RLock()
 	client, ok := s.connections[username]
 	s.connMu.RUnlock()
 	if !ok {
 		return
 	}
-	data, _ := json.Marshal(payload)
+	data := protocol.Encode(msg)
 	select {
 	case client.send <- data:
 	default:
 	}
 }
 
-func (s *Server) findOpponent(g *game.GameState, username string) string {
-	for name, p := range g.Players {
+func findOpponent(v game.View, username string) string {
+	for name, p := range v.Players {
 		if name != username && !p.IsBot {
 			return name
 		}
 	}
-	if g.Bot != nil {
+	if v.Bot != nil {
 		return "bot"
 	}
 	return ""
 }
 
-func (s *Server) onFinish(g *game.GameState) {
-	if g.Winner != "" && g.Winner != "bot" {
-		s.winMu.Lock()
-		s.inMemoryWins[g.Winner]++
-		s.winMu.Unlock()
-	}
-	if s.store != nil {
-		_ = s.store.SaveGame(context.Background(), storage.CompletedGame{
-			ID:        g.ID,
-			Winner:    g.Winner,
-			Status:    g.Status,
-			StartedAt: g.StartedAt,
-			EndedAt:   g.EndedAt,
-		})
+func slotUsernames(g *game.GameState) (string, string) {
+	var player1, player2 string
+	for name, p := range g.Players {
+		switch p.Slot {
+		case game.CellP1:
+			player1 = name
+		case game.CellP2:
+			player2 = name
+		}
 	}
-	if s.analytics != nil {
-		players := make([]string, 0, len(g.Players))
-		for uname := range g.Players {
-			if uname != "bot" {
-				players = append(players, uname)
-			} else {
-				players = append(players, "bot")
-			}
+	return player1, player2
+}
+
+func completedMoves(moves []game.MoveRecord) []storage.Move {
+	res := make([]storage.Move, len(moves))
+	for i, m := range moves {
+		res[i] = storage.Move{
+			Ply:      m.Number,
+			Action:   string(m.Action),
+			Column:   m.Column,
+			Row:      m.Row,
+			Player:   m.Slot,
+			PlayedAt: m.PlayedAt,
 		}
-		duration := g.EndedAt.Sub(g.StartedAt).Seconds()
-		s.analytics.Publish(context.Background(), "game_finished", map[string]any{
-			"gameId":   g.ID,
-			"winner":   g.Winner,
-			"status":   g.Status,
-			"players":  players,
-			"duration": duration,
-			"startedAt": g.StartedAt,
-			"endedAt":   g.EndedAt,
-		})
 	}
+	return res
 }
 
-func (s *Server) playBotTurn(g *game.GameState) {
-	bot := g.Bot
-	if bot == nil {
+func (s *Server) playBotTurn(gameID string) {
+	v, ok := s.manager.View(gameID)
+	if !ok || v.Bot == nil {
+		return
+	}
+	ctx := context.Background()
+	if s.botMoveTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.botMoveTimeout)
+		defer cancel()
+	}
+	col, err := v.Bot.ChooseMove(ctx, v.Board)
+	action := game.ActionDrop
+	if errors.Is(err, game.ErrNoMove) && v.Rules.Variant == game.VariantPopOut {
+		// Strategies only drop discs; once the board is full a PopOut
+		// bot has to pop.
+		if pop, ok := game.ChoosePop(v.Rules, v.Board, v.Players["bot"].Slot); ok {
+			col, action, err = pop, game.ActionPop, nil
+		}
+	}
+	if err != nil {
+		log.Printf("bot %s failed to move in game %s: %v", v.Bot.Name(), v.ID, err)
 		return
 	}
-	col := bot.ChooseMove(g.Board)
 	move := game.Move{
 		Username: "bot",
-		GameID:   g.ID,
+		GameID:   v.ID,
+		Action:   action,
 		Column:   col,
 	}
-	res, g, err := s.manager.HandleMove(move)
-	if err != nil {
+	if _, _, err := s.manager.HandleMove(move); err != nil {
 		return
 	}
-	s.broadcastState(g, res)
+	s.pushState(v.ID)
 }
 
-func (c *wsClient) sendJSON(v any) {
-	data, _ := json.Marshal(v)
+func (c *wsClient) sendMessage(msg protocol.Message) {
+	data := protocol.Encode(msg)
 	select {
 	case c.send <- data:
 	default:
 	}
 }
-
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"emittr/backend/internal/game"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A session token proves who a websocket client is. Logging in,
+// registering or creating a guest account returns one, and the server
+// sends a fresh one in a session message on every connect; rejoining a
+// game the username plays in requires it. Tokens are JWTs signed with
+// HMAC-SHA256 under the server secret: the base64url encoded header and
+// claims and their signature, joined by dots.
+
+// DefaultSessionTTL is how long a session token stays valid.
+const DefaultSessionTTL = 24 * time.Hour
+
+var (
+	ErrInvalidSession   = errors.New("invalid or expired session token")
+	ErrSessionRequired  = errors.New("session token required to rejoin this game")
+	ErrAlreadyConnected = errors.New("already connected from another session")
+)
+
+// sessionHeader is the encoded header of every token.
+var sessionHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type sessionClaims struct {
+	Username string `json:"sub"`
+	IssuedAt int64  `json:"iat"`
+	Expires  int64  `json:"exp"`
+}
+
+type sessions struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// newSessions signs tokens with secret, or with a random key when it is
+// empty, in which case tokens do not survive a restart.
+func newSessions(secret string, ttl time.Duration) *sessions {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+		log.Printf("no session secret configured; session tokens end with the process")
+	}
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	return &sessions{secret: key, ttl: ttl}
+}
+
+func (s *sessions) issue(username string, now time.Time) string {
+	claims, _ := json.Marshal(sessionClaims{Username: username, IssuedAt: now.Unix(), Expires: now.Add(s.ttl).Unix()})
+	payload := sessionHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload))
+}
+
+// verify returns the claims of token if it is signed with the secret
+// and still valid.
+func (s *sessions) verify(token string, now time.Time) (sessionClaims, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return sessionClaims{}, ErrInvalidSession
+	}
+	payload, sig := token[:i], token[i+1:]
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, s.sign(payload)) {
+		return sessionClaims{}, ErrInvalidSession
+	}
+	header, body, ok := strings.Cut(payload, ".")
+	if !ok || header != sessionHeader {
+		return sessionClaims{}, ErrInvalidSession
+	}
+	data, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return sessionClaims{}, ErrInvalidSession
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(data, &claims); err != nil || claims.Username == "" {
+		return sessionClaims{}, ErrInvalidSession
+	}
+	if now.Unix() >= claims.Expires {
+		return sessionClaims{}, ErrInvalidSession
+	}
+	return claims, nil
+}
+
+func (s *sessions) sign(payload string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// authorize works out who the websocket request plays as and returns a
+// fresh token for them. A token names the player by itself, and a
+// username sent along with it must match; without a token the username
+// parameter does, unless an account owns it. A token is also required to
+// rejoin gameID or the game the username is playing; without one the
+// request may only start something new. takeover reports whether the
+// request proved its identity with a token, in which case it may replace
+// a connection of the username that went stale; a live one still refuses
+// it.
+func (s *Server) authorize(c *gin.Context, gameID string) (username, session string, takeover, ok bool) {
+	now := time.Now()
+	username = c.Query("username")
+	if token := c.Query("token"); token != "" {
+		claims, err := s.sessions.verify(token, now)
+		if err == nil && username != "" && claims.Username != username {
+			err = ErrInvalidSession
+		}
+		if err == nil {
+			err = s.checkTokenAccount(c.Request.Context(), claims)
+		}
+		if err != nil {
+			s.refuseIdentity(c, err)
+			return "", "", false, false
+		}
+		username, takeover = claims.Username, true
+	} else {
+		if username == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "username or token required"})
+			return "", "", false, false
+		}
+		if !usernamePattern.MatchString(username) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidUsername.Error()})
+			return "", "", false, false
+		}
+		if err := s.checkNameFree(c.Request.Context(), username); err != nil {
+			s.refuseIdentity(c, err)
+			return "", "", false, false
+		}
+		if s.hasSeat(username, gameID) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": ErrSessionRequired.Error()})
+			return "", "", false, false
+		}
+	}
+	if s.busy(username, takeover) {
+		c.JSON(http.StatusConflict, gin.H{"error": ErrAlreadyConnected.Error()})
+		return "", "", false, false
+	}
+	return username, s.sessions.issue(username, now), takeover, true
+}
+
+// hasSeat reports whether username plays in gameID or in a game in
+// progress.
+func (s *Server) hasSeat(username, gameID string) bool {
+	if v, ok := s.manager.View(gameID); ok {
+		if p, ok := v.Players[username]; ok && !p.IsBot {
+			return true
+		}
+	}
+	v, ok := s.manager.View(s.manager.GameForUser(username, ""))
+	return ok && v.Status == game.StatusActive
+}
+
+// busy reports whether username has a connection a new one may not
+// replace: any connection, or with takeover one that is not stale.
+func (s *Server) busy(username string, takeover bool) bool {
+	s.connMu.RLock()
+	defer s.connMu.RUnlock()
+	return s.busyLocked(username, takeover, time.Now())
+}
+
+func (s *Server) busyLocked(username string, takeover bool, now time.Time) bool {
+	c, ok := s.connections[username]
+	return ok && !(takeover && c.stale(now))
+}
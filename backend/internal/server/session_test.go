@@ -0,0 +1,61 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTokenTakesOverOnlyStaleConnections(t *testing.T) {
+	s := New(Config{BotFallbackAfter: time.Hour, ReconnectWindow: time.Minute})
+	ts := httptest.NewServer(s.router)
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?token=" + s.sessions.issue("alice", time.Now())
+
+	first, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	current := func() *wsClient {
+		s.connMu.RLock()
+		defer s.connMu.RUnlock()
+		return s.connections["alice"]
+	}
+	old := current()
+
+	// A live connection keeps its seat.
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if !errors.Is(err, websocket.ErrBadHandshake) || resp.StatusCode != http.StatusConflict {
+		t.Fatalf("second connection: %v, want %d", err, http.StatusConflict)
+	}
+	if current() != old {
+		t.Fatal("live connection was replaced")
+	}
+
+	// One that missed its pings is taken over and closed.
+	old.heard.Store(time.Now().Add(-staleAfter - time.Second).UnixNano())
+	second, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("takeover of a stale connection: %v", err)
+	}
+	defer second.Close()
+	if c := current(); c == old || c == nil {
+		t.Fatal("stale connection was not replaced")
+	}
+	first.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := first.ReadMessage(); err != nil {
+			var netErr interface{ Timeout() bool }
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				t.Fatal("stale connection was not closed")
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"emittr/backend/internal/game"
+	"emittr/backend/internal/storage"
+)
+
+// snapshotWriter saves game snapshots off the manager's lock. Only the
+// latest snapshot of each game is kept pending, so a slow store costs
+// intermediate positions, never the final one.
+type snapshotWriter struct {
+	store   storage.SnapshotStore
+	mu      sync.Mutex
+	pending map[string]game.Snapshot
+	wake    chan struct{}
+	closed  bool
+	// done is closed once the last pending snapshot is written.
+	done chan struct{}
+}
+
+func newSnapshotWriter(store storage.SnapshotStore) *snapshotWriter {
+	return &snapshotWriter{
+		store:   store,
+		pending: make(map[string]game.Snapshot),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// enqueue is the manager's snapshotter; it runs under the manager's lock.
+func (w *snapshotWriter) enqueue(snap game.Snapshot) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		log.Printf("snapshot of game %s dropped during shutdown", snap.ID)
+		return
+	}
+	w.pending[snap.ID] = snap
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close stops the writer taking snapshots; run writes the pending ones
+// and then closes done.
+func (w *snapshotWriter) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.closed = true
+		close(w.wake)
+	}
+}
+
+func (w *snapshotWriter) run() {
+	defer close(w.done)
+	for range w.wake {
+		w.writePending()
+	}
+	// The last snapshots may have shared a wake-up with the close.
+	w.writePending()
+}
+
+func (w *snapshotWriter) writePending() {
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = make(map[string]game.Snapshot)
+	w.mu.Unlock()
+	for id, snap := range batch {
+		w.write(id, snap)
+	}
+}
+
+func (w *snapshotWriter) write(id string, snap game.Snapshot) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if snap.Status == game.StatusFinished {
+		// Finished games live in the game store from now on.
+		if err := w.store.DeleteSnapshot(ctx, id); err != nil {
+			log.Printf("delete snapshot of game %s failed: %v", id, err)
+		}
+		return
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		log.Printf("encode snapshot of game %s failed: %v", id, err)
+		return
+	}
+	if err := w.store.SaveSnapshot(ctx, id, data); err != nil {
+		log.Printf("save snapshot of game %s failed: %v", id, err)
+	}
+}
+
+// restoreSnapshots resumes the games saved before the last shutdown.
+func (s *Server) restoreSnapshots(store storage.SnapshotStore) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	docs, err := store.LoadSnapshots(ctx)
+	if err != nil {
+		log.Printf("load snapshots failed: %v", err)
+		return
+	}
+	snaps := make([]game.Snapshot, 0, len(docs))
+	for _, data := range docs {
+		var snap game.Snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			log.Printf("skipping unreadable snapshot: %v", err)
+			continue
+		}
+		snaps = append(snaps, snap)
+	}
+	restored := s.manager.Restore(snaps, s.lastLogged(ctx, snaps))
+	if len(restored) > 0 {
+		log.Printf("restored %d games from snapshots", len(restored))
+	}
+}
+
+// lastLogged returns the Seq of the last logged event of each game in
+// snaps, so their restore events continue the log rather than collide
+// with events it already holds.
+func (s *Server) lastLogged(ctx context.Context, snaps []game.Snapshot) map[string]int {
+	if s.eventLog == nil {
+		return nil
+	}
+	res := make(map[string]int, len(snaps))
+	for _, snap := range snaps {
+		docs, err := s.eventLog.LoadEvents(ctx, snap.ID)
+		if err != nil {
+			log.Printf("load events of game %s failed: %v", snap.ID, err)
+			continue
+		}
+		if len(docs) == 0 {
+			res[snap.ID] = 0
+			continue
+		}
+		var last struct {
+			Seq int `json:"seq"`
+		}
+		if err := json.Unmarshal(docs[len(docs)-1], &last); err != nil {
+			log.Printf("skipping unreadable event of game %s: %v", snap.ID, err)
+			continue
+		}
+		res[snap.ID] = last.Seq
+	}
+	return res
+}
+
+// resumeBotTurns lets bots move in restored games that stopped on their
+// turn.
+func (s *Server) resumeBotTurns() {
+	for _, v := range s.manager.ActiveGames() {
+		if v.BotToMove() {
+			go s.playBotTurn(v.ID)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"emittr/backend/internal/game"
+	"emittr/backend/internal/protocol"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleLiveGames lists the active games open to spectators. Games started
+// from a private room are left out but can still be watched by ID.
+func (s *Server) handleLiveGames(c *gin.Context) {
+	type liveGame struct {
+		ID         string     `json:"id"`
+		Player1    string     `json:"player1"`
+		Player2    string     `json:"player2"`
+		Rules      game.Rules `json:"rules"`
+		Moves      int        `json:"moves"`
+		Spectators int        `json:"spectators"`
+		StartedAt  time.Time  `json:"startedAt"`
+	}
+	res := []liveGame{}
+	for _, v := range s.manager.ActiveGames() {
+		if v.Room != "" {
+			continue
+		}
+		res = append(res, liveGame{
+			ID:         v.ID,
+			Player1:    v.Seated(game.CellP1),
+			Player2:    v.Seated(game.CellP2),
+			Rules:      v.Rules,
+			Moves:      len(v.Moves),
+			Spectators: s.spectatorCount(v.ID),
+			StartedAt:  v.StartedAt,
+		})
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func (s *Server) addSpectator(c *wsClient) {
+	s.connMu.Lock()
+	if s.spectators[c.watch] == nil {
+		s.spectators[c.watch] = make(map[*wsClient]struct{})
+	}
+	s.spectators[c.watch][c] = struct{}{}
+	s.connMu.Unlock()
+}
+
+func (s *Server) removeSpectator(c *wsClient) {
+	s.connMu.Lock()
+	delete(s.spectators[c.watch], c)
+	if len(s.spectators[c.watch]) == 0 {
+		delete(s.spectators, c.watch)
+	}
+	s.connMu.Unlock()
+	c.conn.Close()
+}
+
+func (s *Server) spectatorCount(gameID string) int {
+	s.connMu.RLock()
+	defer s.connMu.RUnlock()
+	return len(s.spectators[gameID])
+}
+
+// sendToSpectators forwards payload to everyone watching gameID.
+func (s *Server) sendToSpectators(gameID string, msg protocol.Message) {
+	data := protocol.Encode(msg)
+	s.connMu.RLock()
+	defer s.connMu.RUnlock()
+	for c := range s.spectators[gameID] {
+		select {
+		case c.send <- data:
+		default:
+		}
+	}
+}
+
+// pushSpectatorCount tells the players of gameID how many people are
+// watching.
+func (s *Server) pushSpectatorCount(gameID string) {
+	v, ok := s.manager.View(gameID)
+	if !ok {
+		return
+	}
+	msg := protocol.Spectators{GameID: v.ID, Spectators: s.spectatorCount(v.ID)}
+	for uname := range v.Players {
+		if uname == "bot" {
+			continue
+		}
+		s.sendToUser(uname, msg)
+	}
+}
+
+// watchPump serves a spectator: the current game, then every update that
+// pushState sends to the players. Spectators cannot move.
+func (c *wsClient) watchPump() {
+	s := c.server
+	defer func() {
+		s.removeSpectator(c)
+		s.pushSpectatorCount(c.watch)
+	}()
+
+	v, ok := s.manager.View(c.watch)
+	if !ok {
+		return
+	}
+	c.sendMessage(protocol.Welcome{Protocol: c.protocol})
+	c.sendMessage(protocol.Init{
+		GameID:    v.ID,
+		Spectator: true,
+		Rules:     v.Rules,
+		Board:     v.Board,
+		Turn:      v.Turn,
+		Players:   []string{v.Seated(game.CellP1), v.Seated(game.CellP2)},
+		Status:    v.Status,
+		Winner:    v.Winner,
+		Reason:    v.Reason,
+		Moves:     v.Moves,
+		Clock:     v.Clock,
+		Timestamp: time.Now().UTC(),
+	})
+	s.pushSpectatorCount(v.ID)
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if _, err := protocol.Decode(data); err != nil {
+			c.sendMessage(protocol.ErrorFor(err))
+			continue
+		}
+		c.sendMessage(protocol.Error{Code: protocol.CodeReadOnly, Message: "spectators cannot play"})
+	}
+}
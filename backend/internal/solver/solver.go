@@ -0,0 +1,379 @@
+// Package solver computes exact game-theoretic values of 4 in a Row
+// positions: who wins under perfect play and how quickly. It handles
+// games under game.StandardRules only.
+//
+// Scores follow the usual convention for the game: zero is a draw, a
+// positive score means the player to move wins and grows the earlier the
+// win comes, a negative score means the opponent wins.
+package solver
+
+import (
+	"context"
+	"errors"
+	"math/bits"
+	"time"
+
+	"emittr/backend/internal/game"
+)
+
+// rules are the only rules the solver handles.
+var (
+	rules = game.StandardRules
+	cells = rules.Columns * rules.Rows
+)
+
+var (
+	ErrBudgetExceeded = errors.New("solver budget exceeded")
+	ErrInvalidPlayer  = errors.New("invalid player")
+	ErrUnsupported    = errors.New("solver supports the standard 7x6 board only")
+)
+
+// Outcome is the result of a position for the player to move.
+type Outcome string
+
+const (
+	OutcomeWin     Outcome = "win"
+	OutcomeLoss    Outcome = "loss"
+	OutcomeDraw    Outcome = "draw"
+	OutcomeUnknown Outcome = "unknown"
+)
+
+// Result describes a solved position. When the budget runs out before
+// the search completes Exact is false and only Lower and Upper, the
+// bounds proven so far, are meaningful (Outcome may still be known).
+type Result struct {
+	Outcome Outcome `json:"outcome"`
+	// Winner is the slot that wins with perfect play, 0 for a draw or an
+	// unknown result.
+	Winner int `json:"winner"`
+	Score  int `json:"score"`
+	// Plies counts the moves left in the game under perfect play,
+	// including the winning move.
+	Plies int `json:"plies"`
+	// WinnerMoves counts the discs the winner still has to drop, as in
+	// "Red wins in 13 moves".
+	WinnerMoves int    `json:"winnerMoves"`
+	Exact       bool   `json:"exact"`
+	Lower       int    `json:"lower"`
+	Upper       int    `json:"upper"`
+	Nodes       uint64 `json:"nodes"`
+}
+
+// MoveScore is the result of playing Column, seen from the mover's side.
+type MoveScore struct {
+	Column int    `json:"column"`
+	Result Result `json:"result"`
+}
+
+// Solver holds the transposition table reused across calls. It is safe
+// for concurrent use.
+type Solver struct {
+	table *game.TranspositionTable
+}
+
+// New creates a solver caching up to tableSize positions.
+func New(tableSize int) *Solver {
+	return &Solver{table: game.NewTranspositionTable(tableSize)}
+}
+
+// Solve returns the value of board for player to move. A positive budget
+// bounds the wall time of the call; ctx cancels it early. On timeout or
+// cancellation the partial Result is returned with the error.
+func (s *Solver) Solve(ctx context.Context, board game.Board, player int, budget time.Duration) (Result, error) {
+	if player != game.CellP1 && player != game.CellP2 {
+		return Result{}, ErrInvalidPlayer
+	}
+	if !standard(board) {
+		return Result{}, ErrUnsupported
+	}
+	pos := game.NewPosition(board, rules.Connect)
+	if pos.HasWon(game.CellP1) || pos.HasWon(game.CellP2) {
+		return Result{}, game.ErrGameFinished
+	}
+	if budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+	r := &run{ctx: ctx, table: s.table}
+	res := r.solve(&pos, player)
+	if r.aborted {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return res, ErrBudgetExceeded
+		}
+		return res, ctx.Err()
+	}
+	return res, nil
+}
+
+// ScoreMoves solves the position after every legal move of player, for
+// grading the moves of a finished game. The budget covers all moves.
+func (s *Solver) ScoreMoves(ctx context.Context, board game.Board, player int, budget time.Duration) ([]MoveScore, error) {
+	if player != game.CellP1 && player != game.CellP2 {
+		return nil, ErrInvalidPlayer
+	}
+	if !standard(board) {
+		return nil, ErrUnsupported
+	}
+	if budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+	pos := game.NewPosition(board, rules.Connect)
+	var scores []MoveScore
+	for col := 0; col < rules.Columns; col++ {
+		if !pos.CanPlay(col) {
+			continue
+		}
+		if pos.IsWinningMove(col, player) {
+			score := (cells + 1 - pos.Moves()) / 2
+			scores = append(scores, MoveScore{Column: col, Result: describe(score, score, pos.Moves(), player)})
+			continue
+		}
+		child := game.CopyBoard(board)
+		if _, err := child.ApplyMove(col, player, rules.Connect); err != nil {
+			return scores, err
+		}
+		res, err := s.Solve(ctx, child, opponent(player), 0)
+		// Flip the child's result back to the mover's point of view.
+		res = describe(-res.Upper, -res.Lower, pos.Moves(), player)
+		scores = append(scores, MoveScore{Column: col, Result: res})
+		if err != nil {
+			return scores, err
+		}
+	}
+	return scores, nil
+}
+
+// BestMove returns a move of player with the best exact score, so the
+// solver can play as game.Solver. It reports false for boards it does not
+// handle, positions without a move and those not solved before ctx is
+// done. Among equally good moves it prefers the center.
+func (s *Solver) BestMove(ctx context.Context, board game.Board, player int) (int, bool) {
+	scores, err := s.ScoreMoves(ctx, board, player, 0)
+	if err != nil || len(scores) == 0 {
+		return -1, false
+	}
+	best := scores[0]
+	for _, ms := range scores[1:] {
+		if ms.Result.Score > best.Result.Score ||
+			ms.Result.Score == best.Result.Score && centerDistance(ms.Column) < centerDistance(best.Column) {
+			best = ms
+		}
+	}
+	return best.Column, true
+}
+
+func centerDistance(col int) int {
+	d := 2*col - (rules.Columns - 1)
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+type run struct {
+	ctx     context.Context
+	table   *game.TranspositionTable
+	nodes   uint64
+	aborted bool
+}
+
+// solve narrows the score window with null-window searches, probing near
+// zero first and then toward quicker wins, like iterative deepening on
+// the distance to the end of the game.
+func (r *run) solve(pos *game.Position, player int) Result {
+	moves := pos.Moves()
+	if pos.Full() {
+		return r.finish(0, 0, moves, player)
+	}
+	for col := 0; col < rules.Columns; col++ {
+		if pos.CanPlay(col) && pos.IsWinningMove(col, player) {
+			score := (cells + 1 - moves) / 2
+			return r.finish(score, score, moves, player)
+		}
+	}
+	lo, hi := -(cells-moves)/2, (cells+1-moves)/2
+	for lo < hi {
+		med := lo + (hi-lo)/2
+		if med <= 0 && lo/2 < med {
+			med = lo / 2
+		} else if med >= 0 && hi/2 > med {
+			med = hi / 2
+		}
+		v := r.negamax(pos, player, med, med+1)
+		if r.aborted {
+			break
+		}
+		if v <= med {
+			hi = v
+		} else {
+			lo = v
+		}
+	}
+	return r.finish(lo, hi, moves, player)
+}
+
+func (r *run) finish(lo, hi, moves, player int) Result {
+	res := describe(lo, hi, moves, player)
+	res.Nodes = r.nodes
+	return res
+}
+
+func (r *run) negamax(pos *game.Position, player, alpha, beta int) int {
+	r.nodes++
+	if r.nodes&4095 == 0 && r.ctx.Err() != nil {
+		r.aborted = true
+	}
+	if r.aborted {
+		return 0
+	}
+	opp := opponent(player)
+	moves := pos.Moves()
+
+	// The player to move cannot win at once (the caller checked), so the
+	// only way to survive an opponent threat is to block it, and never
+	// by playing right underneath another one.
+	next := pos.Playable()
+	threats := pos.WinningCells(opp)
+	if forced := next & threats; forced != 0 {
+		if forced&(forced-1) != 0 {
+			return -(cells - moves) / 2
+		}
+		next = forced
+	}
+	next &^= threats >> 1
+	if next == 0 {
+		return -(cells - moves) / 2
+	}
+	if moves >= cells-2 {
+		return 0
+	}
+
+	lower := -(cells - 2 - moves) / 2
+	upper := (cells - 1 - moves) / 2
+	key := pos.Key(player)
+	if e, ok := r.table.Probe(key); ok {
+		switch e.Bound {
+		case game.BoundUpper:
+			upper = min(upper, int(e.Score))
+		case game.BoundLower:
+			lower = max(lower, int(e.Score))
+		}
+	}
+	if alpha < lower {
+		alpha = lower
+		if alpha >= beta {
+			return alpha
+		}
+	}
+	if beta > upper {
+		beta = upper
+		if alpha >= beta {
+			return beta
+		}
+	}
+
+	for _, col := range r.order(pos, player, next) {
+		pos.Play(col, player)
+		score := -r.negamax(pos, opp, -beta, -alpha)
+		pos.Undo(col)
+		if r.aborted {
+			return 0
+		}
+		if score >= beta {
+			r.table.Store(game.TTEntry{Key: key, Score: int32(score), Move: int8(col), Bound: game.BoundLower})
+			return score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	r.table.Store(game.TTEntry{Key: key, Score: int32(alpha), Move: -1, Bound: game.BoundUpper})
+	return alpha
+}
+
+// order sorts the candidate columns by how many winning cells the move
+// creates, breaking ties toward the center.
+func (r *run) order(pos *game.Position, player int, candidates uint64) []int {
+	cols := make([]int, 0, rules.Columns)
+	threats := make([]int, 0, rules.Columns)
+	for _, col := range centerOrder {
+		if candidates&pos.ColumnMask(col) == 0 {
+			continue
+		}
+		pos.Play(col, player)
+		n := bits.OnesCount64(pos.WinningCells(player) & ^pos.Occupied())
+		pos.Undo(col)
+		i := len(cols)
+		cols = append(cols, col)
+		threats = append(threats, n)
+		for i > 0 && threats[i-1] < n {
+			cols[i], threats[i] = cols[i-1], threats[i-1]
+			i--
+		}
+		cols[i], threats[i] = col, n
+	}
+	return cols
+}
+
+// describe converts a proven score interval into a Result for the player
+// to move in a position with the given number of discs.
+func describe(lo, hi, moves, player int) Result {
+	res := Result{Lower: lo, Upper: hi, Score: lo, Exact: lo == hi, Outcome: OutcomeUnknown}
+	switch {
+	case lo > 0:
+		res.Outcome, res.Winner = OutcomeWin, player
+	case hi < 0:
+		res.Outcome, res.Winner = OutcomeLoss, opponent(player)
+	case lo == 0 && hi == 0:
+		res.Outcome = OutcomeDraw
+		res.Plies = cells - moves
+	}
+	if res.Exact && lo != 0 {
+		res.Plies, res.WinnerMoves = distance(lo, moves)
+	}
+	return res
+}
+
+// distance turns a non-zero score into the plies left in the game and
+// the number of discs the winner still drops.
+func distance(score, moves int) (int, int) {
+	first := moves
+	if score < 0 {
+		score = -score
+		first = moves + 1
+	}
+	// The winning disc is dropped onto a board holding last discs, which
+	// has the parity of the winner's turns.
+	last := cells + 1 - 2*score
+	if (last-first)%2 != 0 {
+		last--
+	}
+	return last - moves + 1, (last-first)/2 + 1
+}
+
+var centerOrder = func() []int {
+	order := make([]int, 0, rules.Columns)
+	for d := 0; len(order) < rules.Columns; d++ {
+		if c := rules.Columns/2 - d; c >= 0 {
+			order = append(order, c)
+		}
+		if c := rules.Columns/2 + d; d > 0 && c < rules.Columns {
+			order = append(order, c)
+		}
+	}
+	return order
+}()
+
+func standard(board game.Board) bool {
+	return board.Columns() == rules.Columns && board.Rows() == rules.Rows
+}
+
+func opponent(player int) int {
+	if player == game.CellP1 {
+		return game.CellP2
+	}
+	return game.CellP1
+}
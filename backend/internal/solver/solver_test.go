@@ -0,0 +1,71 @@
+package solver
+
+import (
+	"context"
+	"testing"
+
+	"emittr/backend/internal/game"
+)
+
+func TestSolveKnownPositions(t *testing.T) {
+	tests := []struct {
+		name string
+		pos  string
+		want Result
+		// best is the column BestMove should pick.
+		best int
+	}{
+		{
+			name: "forced win",
+			pos:  "7/7/rryryry/yyyrrry/rrryyyr/ryyyrry r",
+			want: Result{Outcome: OutcomeWin, Winner: game.CellP1, Score: 4, Plies: 7, WinnerMoves: 4, Exact: true, Lower: 4, Upper: 4},
+			best: 3,
+		},
+		{
+			name: "forced loss",
+			pos:  "7/7/rryyyry/yyyryry/rrryryr/yryrryr r",
+			want: Result{Outcome: OutcomeLoss, Winner: game.CellP2, Score: -4, Plies: 8, WinnerMoves: 4, Exact: true, Lower: -4, Upper: -4},
+			best: 2,
+		},
+		{
+			// Either move fills the board without a line.
+			name: "draw at the end",
+			pos:  "rryrr2/yryryrr/ryyryyy/yrryrry/yyryrrr/ryyyryy r",
+			want: Result{Outcome: OutcomeDraw, Plies: 2, Exact: true},
+			best: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board, player, err := game.ParsePosition(tt.pos)
+			if err != nil {
+				t.Fatalf("ParsePosition: %v", err)
+			}
+			s := New(1 << 16)
+			got, err := s.Solve(context.Background(), board, player, 0)
+			if err != nil {
+				t.Fatalf("Solve: %v", err)
+			}
+			got.Nodes = 0
+			if got != tt.want {
+				t.Errorf("Solve = %+v, want %+v", got, tt.want)
+			}
+			col, ok := s.BestMove(context.Background(), board, player)
+			if !ok || col != tt.best {
+				t.Errorf("BestMove = %d, %v, want %d, true", col, ok, tt.best)
+			}
+			scores, err := s.ScoreMoves(context.Background(), board, player, 0)
+			if err != nil {
+				t.Fatalf("ScoreMoves: %v", err)
+			}
+			for _, ms := range scores {
+				if ms.Result.Score > tt.want.Score {
+					t.Errorf("column %d scores %d, better than the position's %d", ms.Column, ms.Result.Score, tt.want.Score)
+				}
+				if ms.Column == tt.best && ms.Result.Score != tt.want.Score {
+					t.Errorf("best column %d scores %d, want %d", ms.Column, ms.Result.Score, tt.want.Score)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrAccountNotFound = errors.New("account not found")
+	ErrAccountExists   = errors.New("username is already taken")
+)
+
+// Account owns a username. Registered accounts carry the bcrypt hash of
+// their password; guest accounts have none and can only be used through
+// the token issued when they were created.
+type Account struct {
+	Username     string    `json:"username"`
+	PasswordHash []byte    `json:"-"`
+	Guest        bool      `json:"guest"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// AccountStore keeps the accounts that own usernames.
+type AccountStore interface {
+	// CreateAccount stores a new account, or returns ErrAccountExists if
+	// its username is taken.
+	CreateAccount(ctx context.Context, account Account) error
+	// LoadAccount returns the account of username, or ErrAccountNotFound.
+	LoadAccount(ctx context.Context, username string) (Account, error)
+}
+
+func (p *PostgresStore) CreateAccount(ctx context.Context, account Account) error {
+	_, err := p.pool.Exec(ctx, `INSERT INTO accounts (username, password_hash, guest, created_at) VALUES ($1, $2, $3, $4)`,
+		account.Username, account.PasswordHash, account.Guest, account.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrAccountExists
+	}
+	return err
+}
+
+func (p *PostgresStore) LoadAccount(ctx context.Context, username string) (Account, error) {
+	account := Account{Username: username}
+	var createdAt *time.Time
+	err := p.pool.QueryRow(ctx, `SELECT password_hash, guest, created_at FROM accounts WHERE username = $1`, username).
+		Scan(&account.PasswordHash, &account.Guest, &createdAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Account{}, ErrAccountNotFound
+	}
+	if err != nil {
+		return Account{}, err
+	}
+	if createdAt != nil {
+		account.CreatedAt = *createdAt
+	}
+	return account, nil
+}
+
+func (m *MemoryStore) CreateAccount(ctx context.Context, account Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.accounts[account.Username]; exists {
+		return ErrAccountExists
+	}
+	account.PasswordHash = append([]byte(nil), account.PasswordHash...)
+	m.accounts[account.Username] = account
+	return nil
+}
+
+func (m *MemoryStore) LoadAccount(ctx context.Context, username string) (Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	account, ok := m.accounts[username]
+	if !ok {
+		return Account{}, ErrAccountNotFound
+	}
+	return account, nil
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// EventStore is the durable, append-only log of game events. Events are
+// opaque encoded documents numbered per game from 1.
+type EventStore interface {
+	// AppendEvent adds event seq of gameID. Events of a game must be
+	// appended in order; appending a seq already stored is a no-op.
+	AppendEvent(ctx context.Context, gameID string, seq int, data []byte) error
+	// LoadEvents returns the events of gameID in order.
+	LoadEvents(ctx context.Context, gameID string) ([][]byte, error)
+	// EventGames returns the ID of every game in the log, in no particular
+	// order.
+	EventGames(ctx context.Context) ([]string, error)
+}
+
+func (p *PostgresStore) AppendEvent(ctx context.Context, gameID string, seq int, data []byte) error {
+	_, err := p.pool.Exec(ctx, `INSERT INTO game_events (game_id, seq, data) VALUES ($1, $2, $3)
+ON CONFLICT (game_id, seq) DO NOTHING`, gameID, seq, data)
+	return err
+}
+
+func (p *PostgresStore) LoadEvents(ctx context.Context, gameID string) ([][]byte, error) {
+	rows, err := p.pool.Query(ctx, `SELECT data FROM game_events WHERE game_id = $1 ORDER BY seq`, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res [][]byte
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		res = append(res, data)
+	}
+	return res, rows.Err()
+}
+
+func (p *PostgresStore) EventGames(ctx context.Context) ([]string, error) {
+	rows, err := p.pool.Query(ctx, `SELECT DISTINCT game_id FROM game_events`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		res = append(res, id)
+	}
+	return res, rows.Err()
+}
+
+func (m *MemoryStore) AppendEvent(ctx context.Context, gameID string, seq int, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	log := m.events[gameID]
+	if seq <= len(log) {
+		return nil
+	}
+	if log == nil {
+		m.eventGames = append(m.eventGames, gameID)
+	}
+	m.events[gameID] = append(log, append([]byte(nil), data...))
+	return nil
+}
+
+func (m *MemoryStore) LoadEvents(ctx context.Context, gameID string) ([][]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([][]byte(nil), m.events[gameID]...), nil
+}
+
+func (m *MemoryStore) EventGames(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.eventGames...), nil
+}
+
+// FileEventStore keeps the log of each game in its own file of JSON
+// lines in a directory, for deployments without a database.
+type FileEventStore struct {
+	dir string
+	mu  sync.Mutex
+	// lengths caches the number of events in each game's file.
+	lengths map[string]int
+}
+
+// NewFileEventStore uses dir, creating it if needed.
+func NewFileEventStore(dir string) (*FileEventStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileEventStore{dir: dir, lengths: make(map[string]int)}, nil
+}
+
+func (f *FileEventStore) path(gameID string) string {
+	return filepath.Join(f.dir, filepath.Base(gameID)+".jsonl")
+}
+
+func (f *FileEventStore) AppendEvent(ctx context.Context, gameID string, seq int, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, ok := f.lengths[gameID]
+	if !ok {
+		events, err := f.read(gameID)
+		if err != nil {
+			return err
+		}
+		n = len(events)
+	}
+	if seq <= n {
+		return nil
+	}
+	file, err := os.OpenFile(f.path(gameID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	line := append(bytes.TrimSpace(data), '\n')
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	f.lengths[gameID] = n + 1
+	return nil
+}
+
+func (f *FileEventStore) LoadEvents(ctx context.Context, gameID string) ([][]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.read(gameID)
+}
+
+func (f *FileEventStore) read(gameID string) ([][]byte, error) {
+	file, err := os.Open(f.path(gameID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var res [][]byte
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		if line := bytes.TrimSpace(sc.Bytes()); len(line) > 0 {
+			res = append(res, append([]byte(nil), line...))
+		}
+	}
+	return res, sc.Err()
+}
+
+func (f *FileEventStore) EventGames(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == ".jsonl" {
+			res = append(res, strings.TrimSuffix(e.Name(), ".jsonl"))
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps completed games in process memory. It backs the
+// server when no database is configured and loses everything on restart.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	games    map[string]CompletedGame
+	ratings  map[string]PlayerRating
+	history  map[string][]RatingPoint // by username, oldest first
+	accounts map[string]Account
+	events   map[string][][]byte // by game ID, in order
+	// eventGames lists the games in events by their first event.
+	eventGames []string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		games:    make(map[string]CompletedGame),
+		ratings:  make(map[string]PlayerRating),
+		history:  make(map[string][]RatingPoint),
+		accounts: make(map[string]Account),
+		events:   make(map[string][][]byte),
+	}
+}
+
+func (m *MemoryStore) SaveGame(ctx context.Context, game CompletedGame) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.games[game.ID]; !exists {
+		game.Moves = append([]Move(nil), game.Moves...)
+		m.games[game.ID] = game
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetLeaderboard(ctx context.Context, limit int) ([]LeaderboardRow, error) {
+	m.mu.RLock()
+	res := make([]LeaderboardRow, 0, len(m.ratings))
+	for _, r := range m.ratings {
+		res = append(res, LeaderboardRow{Username: r.Username, Rating: r.Rating, RD: r.RD, Games: r.Games, Wins: r.Wins})
+	}
+	m.mu.RUnlock()
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Rating != res[j].Rating {
+			return res[i].Rating > res[j].Rating
+		}
+		return res[i].Username < res[j].Username
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (m *MemoryStore) LoadGame(ctx context.Context, id string) (CompletedGame, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	game, ok := m.games[id]
+	if !ok {
+		return CompletedGame{}, ErrNotFound
+	}
+	game.Moves = append([]Move(nil), game.Moves...)
+	return game, nil
+}
+
+func (m *MemoryStore) LoadRatings(ctx context.Context, usernames ...string) (map[string]PlayerRating, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := make(map[string]PlayerRating, len(usernames))
+	for _, name := range usernames {
+		if r, ok := m.ratings[name]; ok {
+			res[name] = r
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryStore) SaveRatings(ctx context.Context, gameID string, ratings []PlayerRating) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range ratings {
+		if m.rated(gameID, r.Username) {
+			continue
+		}
+		m.ratings[r.Username] = r
+		m.history[r.Username] = append(m.history[r.Username], RatingPoint{
+			GameID:     gameID,
+			Rating:     r.Rating,
+			RD:         r.RD,
+			Volatility: r.Volatility,
+			RecordedAt: r.UpdatedAt,
+		})
+	}
+	return nil
+}
+
+func (m *MemoryStore) rated(gameID, username string) bool {
+	for _, pt := range m.history[username] {
+		if pt.GameID == gameID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) RatingHistory(ctx context.Context, username string, limit int) ([]RatingPoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	points := m.history[username]
+	res := make([]RatingPoint, 0, min(limit, len(points)))
+	for i := len(points) - 1; i >= 0 && len(res) < limit; i-- {
+		res = append(res, points[i])
+	}
+	return res, nil
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SnapshotStore keeps the latest snapshot of every game in progress so
+// the server can resume them after a restart. Snapshots are opaque
+// encoded documents, one per game ID.
+type SnapshotStore interface {
+	// SaveSnapshot replaces the snapshot of game id.
+	SaveSnapshot(ctx context.Context, id string, data []byte) error
+	// DeleteSnapshot drops the snapshot of game id, if any.
+	DeleteSnapshot(ctx context.Context, id string) error
+	// LoadSnapshots returns every stored snapshot in no particular order.
+	LoadSnapshots(ctx context.Context) ([][]byte, error)
+}
+
+func (p *PostgresStore) SaveSnapshot(ctx context.Context, id string, data []byte) error {
+	_, err := p.pool.Exec(ctx, `INSERT INTO game_snapshots (id, data, updated_at) VALUES ($1, $2, now())
+ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data, updated_at = EXCLUDED.updated_at`, id, data)
+	return err
+}
+
+func (p *PostgresStore) DeleteSnapshot(ctx context.Context, id string) error {
+	_, err := p.pool.Exec(ctx, `DELETE FROM game_snapshots WHERE id = $1`, id)
+	return err
+}
+
+func (p *PostgresStore) LoadSnapshots(ctx context.Context) ([][]byte, error) {
+	rows, err := p.pool.Query(ctx, `SELECT data FROM game_snapshots`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res [][]byte
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		res = append(res, data)
+	}
+	return res, rows.Err()
+}
+
+// FileSnapshotStore keeps each snapshot in its own JSON file in a
+// directory, for deployments without a database.
+type FileSnapshotStore struct {
+	dir string
+}
+
+// NewFileSnapshotStore uses dir, creating it if needed.
+func NewFileSnapshotStore(dir string) (*FileSnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileSnapshotStore{dir: dir}, nil
+}
+
+func (f *FileSnapshotStore) path(id string) string {
+	// Game IDs are UUIDs; Base keeps anything else inside dir.
+	return filepath.Join(f.dir, filepath.Base(id)+".json")
+}
+
+// SaveSnapshot writes through a temporary file so a crash never leaves a
+// truncated snapshot behind.
+func (f *FileSnapshotStore) SaveSnapshot(ctx context.Context, id string, data []byte) error {
+	tmp, err := os.CreateTemp(f.dir, ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(id))
+}
+
+func (f *FileSnapshotStore) DeleteSnapshot(ctx context.Context, id string) error {
+	err := os.Remove(f.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (f *FileSnapshotStore) LoadSnapshots(ctx context.Context) ([][]byte, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+	var res [][]byte
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(f.dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, data)
+	}
+	return res, nil
+}
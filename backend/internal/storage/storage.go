@@ -2,45 +2,116 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var ErrNotFound = errors.New("game not found")
+
 type CompletedGame struct {
-	ID        string
-	Winner    string
-	Status    string
-	StartedAt time.Time
-	EndedAt   time.Time
+	ID      string `json:"id"`
+	Player1 string `json:"player1"`
+	Player2 string `json:"player2"`
+	Winner  string `json:"winner"`
+	Status  string `json:"status"`
+	// Reason tells how the game ended, e.g. "connect", "full_board",
+	// "resignation" or "forfeit"; empty for games saved before reasons
+	// were recorded.
+	Reason string `json:"reason"`
+	// Columns, Rows, Connect and Variant are the game's board rules.
+	Columns   int       `json:"columns"`
+	Rows      int       `json:"rows"`
+	Connect   int       `json:"connect"`
+	Variant   string    `json:"variant"`
+	StartedAt time.Time `json:"startedAt"`
+	EndedAt   time.Time `json:"endedAt"`
+	Moves     []Move    `json:"moves"`
+}
+
+// Move is one ply of a completed game.
+type Move struct {
+	Ply      int       `json:"ply"`
+	Action   string    `json:"action"`
+	Column   int       `json:"column"`
+	Row      int       `json:"row"`
+	Player   int       `json:"player"`
+	PlayedAt time.Time `json:"playedAt"`
 }
 
 type LeaderboardRow struct {
-	Username string `json:"username"`
-	Wins     int    `json:"wins"`
+	Username string  `json:"username"`
+	Rating   float64 `json:"rating"`
+	RD       float64 `json:"rd"`
+	Games    int     `json:"games"`
+	Wins     int     `json:"wins"`
+}
+
+// PlayerRating is a player's current Glicko-2 rating and rated record.
+type PlayerRating struct {
+	Username   string    `json:"username"`
+	Rating     float64   `json:"rating"`
+	RD         float64   `json:"rd"`
+	Volatility float64   `json:"volatility"`
+	Games      int       `json:"games"`
+	Wins       int       `json:"wins"`
+	Losses     int       `json:"losses"`
+	Draws      int       `json:"draws"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// RatingPoint is a player's rating right after a rated game.
+type RatingPoint struct {
+	GameID     string    `json:"gameId"`
+	Rating     float64   `json:"rating"`
+	RD         float64   `json:"rd"`
+	Volatility float64   `json:"volatility"`
+	RecordedAt time.Time `json:"recordedAt"`
 }
 
 type Store interface {
 	SaveGame(ctx context.Context, game CompletedGame) error
+	// GetLeaderboard ranks rated players by rating.
 	GetLeaderboard(ctx context.Context, limit int) ([]LeaderboardRow, error)
+	// LoadGame returns a completed game with its moves in play order, or
+	// ErrNotFound.
+	LoadGame(ctx context.Context, id string) (CompletedGame, error)
+	// LoadRatings returns the ratings of the given players; players who
+	// have never been rated are missing from the map.
+	LoadRatings(ctx context.Context, usernames ...string) (map[string]PlayerRating, error)
+	// SaveRatings stores the ratings of the players of gameID after it and
+	// adds them to their history. Saving a game twice is a no-op.
+	SaveRatings(ctx context.Context, gameID string, ratings []PlayerRating) error
+	// RatingHistory returns a player's latest ratings, newest first.
+	RatingHistory(ctx context.Context, username string, limit int) ([]RatingPoint, error)
 }
 
+// PostgresStore shares a pool of connections between the request
+// handlers, the projections and the snapshot writer, which all use it at
+// once.
 type PostgresStore struct {
-	pool *pgx.Conn
+	pool *pgxpool.Pool
 }
 
 func NewPostgresStore(ctx context.Context, url string) (*PostgresStore, error) {
-	conn, err := pgx.Connect(ctx, url)
+	pool, err := pgxpool.New(ctx, url)
 	if err != nil {
 		return nil, err
 	}
-	return &PostgresStore{pool: conn}, nil
+	// The pool connects lazily; fail now if the database is unreachable.
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return &PostgresStore{pool: pool}, nil
 }
 
 func (p *PostgresStore) Close(ctx context.Context) {
 	if p.pool != nil {
-		_ = p.pool.Close(ctx)
+		p.pool.Close()
 	}
 }
 
@@ -53,6 +124,63 @@ CREATE TABLE IF NOT EXISTS games (
 	started_at TIMESTAMP,
 	ended_at TIMESTAMP
 );
+ALTER TABLE games ADD COLUMN IF NOT EXISTS player1 TEXT;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS player2 TEXT;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS board_columns INT NOT NULL DEFAULT 7;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS board_rows INT NOT NULL DEFAULT 6;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS connect_n INT NOT NULL DEFAULT 4;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT 'normal';
+ALTER TABLE games ADD COLUMN IF NOT EXISTS reason TEXT NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS moves (
+	game_id TEXT NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+	ply INT NOT NULL,
+	col INT NOT NULL,
+	landed_row INT NOT NULL,
+	player INT NOT NULL,
+	played_at TIMESTAMP,
+	PRIMARY KEY (game_id, ply)
+);
+ALTER TABLE moves ADD COLUMN IF NOT EXISTS action TEXT NOT NULL DEFAULT 'drop';
+CREATE TABLE IF NOT EXISTS ratings (
+	username TEXT PRIMARY KEY,
+	rating DOUBLE PRECISION NOT NULL,
+	rd DOUBLE PRECISION NOT NULL,
+	volatility DOUBLE PRECISION NOT NULL,
+	games INT NOT NULL DEFAULT 0,
+	wins INT NOT NULL DEFAULT 0,
+	losses INT NOT NULL DEFAULT 0,
+	draws INT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS ratings_rating_idx ON ratings (rating DESC);
+CREATE TABLE IF NOT EXISTS rating_history (
+	game_id TEXT NOT NULL,
+	username TEXT NOT NULL,
+	rating DOUBLE PRECISION NOT NULL,
+	rd DOUBLE PRECISION NOT NULL,
+	volatility DOUBLE PRECISION NOT NULL,
+	recorded_at TIMESTAMP,
+	PRIMARY KEY (game_id, username)
+);
+CREATE INDEX IF NOT EXISTS rating_history_user_idx ON rating_history (username, recorded_at DESC);
+CREATE TABLE IF NOT EXISTS game_events (
+	game_id TEXT NOT NULL,
+	seq INT NOT NULL,
+	data JSONB NOT NULL,
+	recorded_at TIMESTAMP NOT NULL DEFAULT now(),
+	PRIMARY KEY (game_id, seq)
+);
+CREATE TABLE IF NOT EXISTS accounts (
+	username TEXT PRIMARY KEY,
+	password_hash BYTEA,
+	guest BOOLEAN NOT NULL DEFAULT false,
+	created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+CREATE TABLE IF NOT EXISTS game_snapshots (
+	id TEXT PRIMARY KEY,
+	data JSONB NOT NULL,
+	updated_at TIMESTAMP NOT NULL DEFAULT now()
+);
 `)
 	return err
 }
@@ -61,8 +189,22 @@ func (p *PostgresStore) SaveGame(ctx context.Context, game CompletedGame) error
 	if p == nil || p.pool == nil {
 		return nil
 	}
-	_, err := p.pool.Exec(ctx, `INSERT INTO games (id, winner, status, started_at, ended_at)
-VALUES ($1,$2,$3,$4,$5) ON CONFLICT (id) DO NOTHING`, game.ID, game.Winner, game.Status, game.StartedAt, game.EndedAt)
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `INSERT INTO games (id, player1, player2, winner, status, reason, board_columns, board_rows, connect_n, variant, started_at, ended_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12) ON CONFLICT (id) DO NOTHING`, game.ID, game.Player1, game.Player2, game.Winner, game.Status, game.Reason,
+			game.Columns, game.Rows, game.Connect, game.Variant, game.StartedAt, game.EndedAt)
+		if err != nil {
+			return err
+		}
+		for _, m := range game.Moves {
+			_, err := tx.Exec(ctx, `INSERT INTO moves (game_id, ply, action, col, landed_row, player, played_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7) ON CONFLICT (game_id, ply) DO NOTHING`, game.ID, m.Ply, m.Action, m.Column, m.Row, m.Player, m.PlayedAt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		log.Printf("failed to save game: %v", err)
 	}
@@ -71,11 +213,9 @@ VALUES ($1,$2,$3,$4,$5) ON CONFLICT (id) DO NOTHING`, game.ID, game.Winner, game
 
 func (p *PostgresStore) GetLeaderboard(ctx context.Context, limit int) ([]LeaderboardRow, error) {
 	rows, err := p.pool.Query(ctx, `
-SELECT winner, COUNT(*) as wins
-FROM games
-WHERE winner IS NOT NULL AND winner <> ''
-GROUP BY winner
-ORDER BY wins DESC
+SELECT username, rating, rd, games, wins
+FROM ratings
+ORDER BY rating DESC, username
 LIMIT $1`, limit)
 	if err != nil {
 		return nil, err
@@ -84,7 +224,7 @@ LIMIT $1`, limit)
 	var res []LeaderboardRow
 	for rows.Next() {
 		var row LeaderboardRow
-		if err := rows.Scan(&row.Username, &row.Wins); err != nil {
+		if err := rows.Scan(&row.Username, &row.Rating, &row.RD, &row.Games, &row.Wins); err != nil {
 			return nil, err
 		}
 		res = append(res, row)
@@ -92,3 +232,115 @@ LIMIT $1`, limit)
 	return res, rows.Err()
 }
 
+func (p *PostgresStore) LoadGame(ctx context.Context, id string) (CompletedGame, error) {
+	game := CompletedGame{ID: id}
+	var player1, player2, winner, status *string
+	var startedAt, endedAt *time.Time
+	err := p.pool.QueryRow(ctx, `SELECT player1, player2, winner, status, reason, board_columns, board_rows, connect_n, variant, started_at, ended_at
+FROM games WHERE id = $1`, id).Scan(&player1, &player2, &winner, &status, &game.Reason, &game.Columns, &game.Rows, &game.Connect, &game.Variant, &startedAt, &endedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return CompletedGame{}, ErrNotFound
+	}
+	if err != nil {
+		return CompletedGame{}, err
+	}
+	game.Player1, game.Player2 = deref(player1), deref(player2)
+	game.Winner, game.Status = deref(winner), deref(status)
+	if startedAt != nil {
+		game.StartedAt = *startedAt
+	}
+	if endedAt != nil {
+		game.EndedAt = *endedAt
+	}
+
+	rows, err := p.pool.Query(ctx, `SELECT ply, action, col, landed_row, player, played_at
+FROM moves WHERE game_id = $1 ORDER BY ply`, id)
+	if err != nil {
+		return CompletedGame{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m Move
+		if err := rows.Scan(&m.Ply, &m.Action, &m.Column, &m.Row, &m.Player, &m.PlayedAt); err != nil {
+			return CompletedGame{}, err
+		}
+		game.Moves = append(game.Moves, m)
+	}
+	return game, rows.Err()
+}
+
+func (p *PostgresStore) LoadRatings(ctx context.Context, usernames ...string) (map[string]PlayerRating, error) {
+	rows, err := p.pool.Query(ctx, `SELECT username, rating, rd, volatility, games, wins, losses, draws, updated_at
+FROM ratings WHERE username = ANY($1)`, usernames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make(map[string]PlayerRating, len(usernames))
+	for rows.Next() {
+		var r PlayerRating
+		var updatedAt *time.Time
+		if err := rows.Scan(&r.Username, &r.Rating, &r.RD, &r.Volatility, &r.Games, &r.Wins, &r.Losses, &r.Draws, &updatedAt); err != nil {
+			return nil, err
+		}
+		if updatedAt != nil {
+			r.UpdatedAt = *updatedAt
+		}
+		res[r.Username] = r
+	}
+	return res, rows.Err()
+}
+
+func (p *PostgresStore) SaveRatings(ctx context.Context, gameID string, ratings []PlayerRating) error {
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		for _, r := range ratings {
+			tag, err := tx.Exec(ctx, `INSERT INTO rating_history (game_id, username, rating, rd, volatility, recorded_at)
+VALUES ($1,$2,$3,$4,$5,$6) ON CONFLICT (game_id, username) DO NOTHING`, gameID, r.Username, r.Rating, r.RD, r.Volatility, r.UpdatedAt)
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() == 0 {
+				// Already rated.
+				continue
+			}
+			_, err = tx.Exec(ctx, `INSERT INTO ratings (username, rating, rd, volatility, games, wins, losses, draws, updated_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+ON CONFLICT (username) DO UPDATE SET rating = EXCLUDED.rating, rd = EXCLUDED.rd, volatility = EXCLUDED.volatility,
+	games = EXCLUDED.games, wins = EXCLUDED.wins, losses = EXCLUDED.losses, draws = EXCLUDED.draws, updated_at = EXCLUDED.updated_at`,
+				r.Username, r.Rating, r.RD, r.Volatility, r.Games, r.Wins, r.Losses, r.Draws, r.UpdatedAt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (p *PostgresStore) RatingHistory(ctx context.Context, username string, limit int) ([]RatingPoint, error) {
+	rows, err := p.pool.Query(ctx, `SELECT game_id, rating, rd, volatility, recorded_at
+FROM rating_history WHERE username = $1 ORDER BY recorded_at DESC LIMIT $2`, username, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []RatingPoint
+	for rows.Next() {
+		var pt RatingPoint
+		var recordedAt *time.Time
+		if err := rows.Scan(&pt.GameID, &pt.Rating, &pt.RD, &pt.Volatility, &recordedAt); err != nil {
+			return nil, err
+		}
+		if recordedAt != nil {
+			pt.RecordedAt = *recordedAt
+		}
+		res = append(res, pt)
+	}
+	return res, rows.Err()
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}